@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/erkexzcx/valetudopng/pkg/config"
 	"github.com/erkexzcx/valetudopng/pkg/server"
@@ -17,6 +18,32 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		var subcommand func([]string) error
+		switch os.Args[1] {
+		case "render":
+			subcommand = runRender
+		case "replay":
+			subcommand = runReplay
+		case "timelapse":
+			subcommand = runTimelapse
+		}
+		if subcommand != nil {
+			if err := subcommand(os.Args[2:]); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+	}
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nSubcommands:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  render\n        render map offline, see \"%s render -help\"\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "  replay\n        replay recorded map data, see \"%s replay -help\"\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "  timelapse\n        render recorded map data as animated GIF, see \"%s timelapse -help\"\n", os.Args[0])
+	}
 	flag.Parse()
 
 	if *flagVersion {
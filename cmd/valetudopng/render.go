@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mqtt/decoder"
+	"github.com/erkexzcx/valetudopng/pkg/server"
+)
+
+// Renders single map without MQTT broker. Input can be Valetudo map JSON, compressed
+// map JSON or Valetudo PNG with embedded map data. Use "-" for stdin/stdout.
+func runRender(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	flagConfigFile := fs.String("config", "config.yml", "Path to configuration file (only map section is used)")
+	flagInput := fs.String("input", "-", "Path to map data file")
+	flagPNG := fs.String("png", "", "Path to output PNG image")
+	flagSVG := fs.String("svg", "", "Path to output SVG image")
+	flagCalibration := fs.String("calibration", "", "Path to output calibration data JSON")
+	fs.Parse(args)
+
+	if *flagPNG == "" && *flagSVG == "" && *flagCalibration == "" {
+		return errors.New("at least one of -png, -svg or -calibration must be set")
+	}
+
+	c, err := config.NewRenderConfig(*flagConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	raw, err := readInput(*flagInput)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	payload, err := decoder.Decode(raw)
+	if err != nil {
+		return fmt.Errorf("failed to process raw data: %w", err)
+	}
+
+	res, err := server.NewRenderer(c.Map).Render(payload, c.Map)
+	if err != nil {
+		return fmt.Errorf("failed to render map: %w", err)
+	}
+
+	if *flagPNG != "" {
+		img, err := res.RenderPNG()
+		if err != nil {
+			return fmt.Errorf("failed to render PNG image: %w", err)
+		}
+		if err := writeOutput(*flagPNG, img); err != nil {
+			return err
+		}
+	}
+
+	if *flagSVG != "" {
+		svg, err := res.RenderSVG()
+		if err != nil {
+			return fmt.Errorf("failed to render SVG image: %w", err)
+		}
+		if err := writeOutput(*flagSVG, svg); err != nil {
+			return err
+		}
+	}
+
+	if *flagCalibration != "" {
+		if err := writeOutput(*flagCalibration, res.Calibration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
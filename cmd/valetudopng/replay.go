@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/server"
+)
+
+// Feeds recorded map payloads (see mqtt.record config section) through the normal
+// render pipeline. Rendered images are published to MQTT and served via HTTP as usual,
+// except MQTT topics use a separate identifier, so retained state of the real robot
+// (and its Home Assistant entities) is not overwritten.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	flagConfigFile := fs.String("config", "config.yml", "Path to configuration file")
+	flagInput := fs.String("input", "", "Path to recorded archive file or directory")
+	flagSpeed := fs.Float64("speed", 1, "Replay speed multiplier, 0 replays without delays")
+	flagIdentifier := fs.String("identifier", "", "Valetudo identifier used in published MQTT topics (default <mqtt.topics.valetudo_identifier>_replay)")
+	fs.Parse(args)
+
+	if *flagInput == "" {
+		return errors.New("missing -input value")
+	}
+	if *flagSpeed < 0 {
+		return errors.New("-speed cannot be negative")
+	}
+
+	c, err := config.NewConfig(*flagConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	if *flagIdentifier == "" {
+		*flagIdentifier = c.Mqtt.Topics.ValetudoIdentifier + "_replay"
+	}
+	if *flagIdentifier == c.Mqtt.Topics.ValetudoIdentifier {
+		return errors.New("-identifier must differ from mqtt.topics.valetudo_identifier")
+	}
+	c.Mqtt.Topics.ValetudoIdentifier = *flagIdentifier
+
+	server.Replay(c, *flagInput, *flagSpeed)
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"time"
+
+	"github.com/erkexzcx/valetudopng/pkg/archive"
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mqtt/decoder"
+	"github.com/erkexzcx/valetudopng/pkg/server"
+	"github.com/erkexzcx/valetudopng/pkg/timelapse"
+)
+
+// Renders recorded map payloads (see mqtt.record config section) as animated GIF.
+// Archive is read twice, so only selected frames are decoded and rendered.
+func runTimelapse(args []string) error {
+	fs := flag.NewFlagSet("timelapse", flag.ExitOnError)
+	flagConfigFile := fs.String("config", "config.yml", "Path to configuration file (only map section is used)")
+	flagInput := fs.String("input", "", "Path to recorded archive file or directory")
+	flagOutput := fs.String("output", "timelapse.gif", "Path to output GIF image")
+	flagFrameRate := fs.Float64("fps", 10, "Frames per second")
+	flagMaxFrames := fs.Int("max-frames", 100, "Max amount of frames, frames are evenly skipped if there are more")
+	flagScale := fs.Float64("scale", 0, "Image scale, 0 uses map.scale")
+	flagFrom := fs.String("from", "", "Only use map data received at or after given time (RFC3339)")
+	flagTo := fs.String("to", "", "Only use map data received before given time (RFC3339)")
+	fs.Parse(args)
+
+	if *flagInput == "" {
+		return errors.New("missing -input value")
+	}
+	if *flagFrameRate <= 0 {
+		return errors.New("-fps must be positive")
+	}
+	if *flagMaxFrames < 1 {
+		return errors.New("-max-frames cannot be lower than 1")
+	}
+	if *flagScale != 0 && *flagScale < 1 {
+		return errors.New("-scale cannot be lower than 1")
+	}
+	from, err := parseTimeFlag(*flagFrom)
+	if err != nil {
+		return fmt.Errorf("invalid -from value: %w", err)
+	}
+	to, err := parseTimeFlag(*flagTo)
+	if err != nil {
+		return fmt.Errorf("invalid -to value: %w", err)
+	}
+	inRange := func(ts time.Time) bool {
+		return (from.IsZero() || !ts.Before(from)) && (to.IsZero() || ts.Before(to))
+	}
+
+	c, err := config.NewRenderConfig(*flagConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	mc := server.TimelapseMapConfig(c.Map, *flagScale)
+	r := server.NewRenderer(mc)
+
+	total := 0
+	err = archive.Read(*flagInput, func(ts time.Time, payload []byte) error {
+		if inRange(ts) {
+			total++
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if total == 0 {
+		return errors.New("no map data found within archive")
+	}
+
+	selected := make(map[int]struct{})
+	for _, i := range timelapse.SelectFrames(total, *flagMaxFrames) {
+		selected[i] = struct{}{}
+	}
+
+	frames := make([]*image.Paletted, 0, len(selected))
+	i := 0
+	err = archive.Read(*flagInput, func(ts time.Time, raw []byte) error {
+		if !inRange(ts) {
+			return nil
+		}
+		defer func() { i++ }()
+		if _, found := selected[i]; !found {
+			return nil
+		}
+
+		payload, err := decoder.Decode(raw)
+		if err != nil {
+			log.Println("Skipping frame, failed to process raw data:", err)
+			return nil
+		}
+		res, err := r.Render(payload, mc)
+		if err != nil {
+			log.Println("Skipping frame, failed to render map:", err)
+			return nil
+		}
+		frames = append(frames, timelapse.NewFrame(*res.Image))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	var b bytes.Buffer
+	if err := timelapse.Encode(&b, frames, &timelapse.Options{FrameRate: *flagFrameRate, MaxFrames: *flagMaxFrames}); err != nil {
+		return fmt.Errorf("failed to encode GIF image: %w", err)
+	}
+	log.Printf("Time-lapse of %d frames (out of %d map updates) rendered\n", len(frames), total)
+	return writeOutput(*flagOutput, b.Bytes())
+}
+
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -4,7 +4,7 @@ go 1.21.1
 
 require github.com/eclipse/paho.mqtt.golang v1.4.3
 
-require github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+require github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 
 require (
 	github.com/bitly/go-simplejson v0.5.1
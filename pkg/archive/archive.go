@@ -0,0 +1,195 @@
+// Package archive stores raw map payloads together with their receive time, so
+// they can be replayed through the render pipeline later on.
+//
+// Archive is a directory of files, where each file is a sequence of records:
+// 8 bytes of receive time (Unix nanoseconds), 4 bytes of payload length and
+// the payload itself. All integers are big endian.
+package archive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	filePrefix = "mapdata-"
+	fileSuffix = ".bin"
+
+	// Protects from allocating huge buffers when reading corrupted files
+	maxPayloadSize = 64 << 20
+)
+
+type Writer struct {
+	mux         sync.Mutex
+	dir         string
+	maxFileSize int64
+	maxFiles    int
+
+	file     *os.File
+	fileSize int64
+}
+
+// Creates a new archive writer. New file is started once current one exceeds
+// maxFileSize bytes, and oldest files are removed once there are more than maxFiles.
+func NewWriter(dir string, maxFileSize int64, maxFiles int) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		dir:         dir,
+		maxFileSize: maxFileSize,
+		maxFiles:    maxFiles,
+	}, nil
+}
+
+func (w *Writer) Write(ts time.Time, payload []byte) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.file == nil || w.fileSize >= w.maxFileSize {
+		if err := w.rotate(ts); err != nil {
+			return err
+		}
+	}
+
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint64(header[0:8], uint64(ts.UnixNano()))
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(payload)))
+	if _, err := w.file.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.file.Write(payload); err != nil {
+		return err
+	}
+	w.fileSize += int64(len(header) + len(payload))
+	return nil
+}
+
+func (w *Writer) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *Writer) rotate(ts time.Time) error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+
+	// File names are sortable by time
+	name := filePrefix + ts.UTC().Format("20060102T150405.000000000") + fileSuffix
+	f, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.fileSize = info.Size()
+
+	files, err := listFiles(w.dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > w.maxFiles && w.maxFiles > 0 {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// Calls fn for every record in given archive file, or in every archive file within
+// given directory, in the order they were recorded. Record cut short by the end of
+// file (e.g. when recorder was killed mid-write) is skipped.
+func Read(path string, fn func(ts time.Time, payload []byte) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = listFiles(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		if err := readFile(file, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(path string, fn func(ts time.Time, payload []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, 12)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		ts := time.Unix(0, int64(binary.BigEndian.Uint64(header[0:8])))
+		length := binary.BigEndian.Uint32(header[8:12])
+		if length > maxPayloadSize {
+			return errors.New(path + ": invalid record payload length")
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if err := fn(ts, payload); err != nil {
+			return err
+		}
+	}
+}
+
+func listFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), filePrefix) || !strings.HasSuffix(e.Name(), fileSuffix) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, e.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
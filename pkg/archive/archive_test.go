@@ -0,0 +1,166 @@
+package archive
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type record struct {
+	ts      time.Time
+	payload string
+}
+
+func writeRecords(t *testing.T, w *Writer, records []record) {
+	t.Helper()
+	for _, r := range records {
+		if err := w.Write(r.ts, []byte(r.payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRecords(t *testing.T, path string) []record {
+	t.Helper()
+	var got []record
+	err := Read(path, func(ts time.Time, payload []byte) error {
+		got = append(got, record{ts, string(payload)})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func testRecords(n int) []record {
+	start := time.Unix(1700000000, 123456789)
+	records := make([]record, n)
+	for i := range records {
+		records[i] = record{start.Add(time.Duration(i) * time.Second), string(rune('a'+i)) + `{"pixelSize":5}`}
+	}
+	return records
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir, 1<<20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := testRecords(3)
+	writeRecords(t, w, records)
+
+	files, err := listFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+
+	// Header is receive time and payload length, followed by payload
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := int64(binary.BigEndian.Uint64(data[0:8])); ts != records[0].ts.UnixNano() {
+		t.Errorf("got timestamp %d in header", ts)
+	}
+	if length := binary.BigEndian.Uint32(data[8:12]); int(length) != len(records[0].payload) {
+		t.Errorf("got payload length %d in header", length)
+	}
+	if payload := string(data[12 : 12+len(records[0].payload)]); payload != records[0].payload {
+		t.Errorf("got payload %q", payload)
+	}
+
+	// Both directory and single file can be read
+	for _, path := range []string{dir, files[0]} {
+		if got := readRecords(t, path); !reflect.DeepEqual(got, records) {
+			t.Errorf("got %v from %s, want %v", got, path, records)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	// Every record exceeds max file size, so each one starts a new file
+	w, err := NewWriter(dir, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := testRecords(5)
+	writeRecords(t, w, records)
+
+	files, err := listFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	// Oldest files are removed
+	if got := readRecords(t, dir); !reflect.DeepEqual(got, records[3:]) {
+		t.Errorf("got %v, want %v", got, records[3:])
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	records := testRecords(4)
+	for name, cut := range map[string]int{"header": 20, "payload": 3} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			// Two files, as recorder starts a new one after restart
+			w, err := NewWriter(dir, 1<<20, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeRecords(t, w, records[:2])
+			files, err := listFiles(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, err = NewWriter(dir, 1<<20, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeRecords(t, w, records[2:])
+
+			// Killed in the middle of writing last record of the first file
+			info, err := os.Stat(files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Truncate(files[0], info.Size()-int64(cut)); err != nil {
+				t.Fatal(err)
+			}
+
+			want := append([]record{records[0]}, records[2:]...)
+			if got := readRecords(t, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadInvalidLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), filePrefix+"0"+fileSuffix)
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint32(header[8:12], maxPayloadSize+1)
+	if err := os.WriteFile(path, header, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := Read(path, func(time.Time, []byte) error { return nil })
+	if err == nil {
+		t.Fatal("expected error for invalid payload length")
+	}
+}
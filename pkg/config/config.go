@@ -12,11 +12,60 @@ type MQTTConfig struct {
 	Connection    *ConnectionConfig `yaml:"connection"`
 	Topics        *TopicsConfig     `yaml:"topics"`
 	ImageAsBase64 bool              `yaml:"image_as_base64"`
+	PublishSVG    bool              `yaml:"publish_svg"`
+	HaMapEntity   string            `yaml:"ha_map_entity"`
+	ImageURL      string            `yaml:"image_url"`
+	Record        *RecordConfig     `yaml:"record"`
+}
+
+type RecordConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Dir           string `yaml:"dir"`
+	MaxFileSizeMB int64  `yaml:"max_file_size_mb"`
+	MaxFiles      int    `yaml:"max_files"`
 }
 
 type HTTPConfig struct {
 	Enabled bool   `yaml:"enabled"`
 	Bind    string `yaml:"bind"`
+	MJPEG   struct {
+		Quality      int           `yaml:"quality"`
+		KeepAliveInt time.Duration `yaml:"keep_alive_int"`
+		Background   string        `yaml:"background"`
+	} `yaml:"mjpeg"`
+}
+
+type HistoryConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Dir          string `yaml:"dir"`
+	MaxSessions  int    `yaml:"max_sessions"`
+	DockDistance int    `yaml:"dock_distance"`
+	Timelapse    struct {
+		Enabled   bool    `yaml:"enabled"`
+		FrameRate float64 `yaml:"fps"`
+		MaxFrames int     `yaml:"max_frames"`
+		Scale     float64 `yaml:"scale"`
+	} `yaml:"timelapse"`
+}
+
+type AlertsConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	StuckTime     time.Duration `yaml:"stuck_time"`
+	StuckDistance int           `yaml:"stuck_distance"`
+	DockDistance  int           `yaml:"dock_distance"`
+}
+
+type MapDiffConfig struct {
+	Enabled   bool    `yaml:"enabled"`
+	Reference string  `yaml:"reference"`
+	MinArea   float64 `yaml:"min_area"`
+	Colors    struct {
+		Floor        string `yaml:"floor"`
+		Wall         string `yaml:"wall"`
+		FloorAdded   string `yaml:"floor_added"`
+		FloorRemoved string `yaml:"floor_removed"`
+		WallAdded    string `yaml:"wall_added"`
+	} `yaml:"colors"`
 }
 
 type ConnectionConfig struct {
@@ -39,29 +88,73 @@ type TopicsConfig struct {
 
 type MapConfig struct {
 	MinRefreshInt  time.Duration `yaml:"min_refresh_int"`
+	Coalesce       bool          `yaml:"coalesce"`
 	PNGCompression int           `yaml:"png_compression"`
 	Scale          float64       `yaml:"scale"`
 	RotationTimes  int           `yaml:"rotate"`
-	CustomLimits   struct {
+	// Max distance (in robot's coordinates system units) to the nearest segment,
+	// when robot is not within any segment
+	RobotSegmentTolerance *int `yaml:"robot_segment_tolerance"`
+	// Width of the area robot cleans while moving (in robot's coordinates system
+	// units), used to calculate coverage from the path
+	BrushWidth   int `yaml:"brush_width"`
+	CustomLimits struct {
 		StartX int `yaml:"start_x"`
 		StartY int `yaml:"start_y"`
 		EndX   int `yaml:"end_x"`
 		EndY   int `yaml:"end_y"`
 	} `yaml:"custom_limits"`
+	Labels struct {
+		Enabled      bool    `yaml:"enabled"`
+		Font         string  `yaml:"font"`
+		Size         float64 `yaml:"size"`
+		OutlineWidth *int    `yaml:"outline_width"`
+		Position     string  `yaml:"position"`
+	} `yaml:"labels"`
+	Heatmap struct {
+		Enabled   bool   `yaml:"enabled"`
+		Mode      string `yaml:"mode"`
+		MaxPasses int    `yaml:"max_passes"`
+	} `yaml:"heatmap"`
+	Obstacles struct {
+		Hide          bool    `yaml:"hide"`
+		Labels        *bool   `yaml:"labels"`
+		LabelSize     float64 `yaml:"label_size"`
+		MinConfidence float64 `yaml:"min_confidence"`
+		Markers       []struct {
+			Class string `yaml:"class"`
+			Label string `yaml:"label"`
+			Color string `yaml:"color"`
+			Icon  string `yaml:"icon"`
+		} `yaml:"markers"`
+	} `yaml:"obstacles"`
 	Colors struct {
-		Floor       string   `yaml:"floor"`
-		Obstacle    string   `yaml:"obstacle"`
-		Path        string   `yaml:"path"`
-		NoGoArea    string   `yaml:"no_go_area"`
-		VirtualWall string   `yaml:"virtual_wall"`
-		Segments    []string `yaml:"segments"`
+		Floor             string   `yaml:"floor"`
+		Obstacle          string   `yaml:"obstacle"`
+		ObstacleMarker    string   `yaml:"obstacle_marker"`
+		Path              string   `yaml:"path"`
+		NoGoArea          string   `yaml:"no_go_area"`
+		VirtualWall       string   `yaml:"virtual_wall"`
+		NoMopArea         string   `yaml:"no_mop_area"`
+		NoMopAreaOutline  string   `yaml:"no_mop_area_outline"`
+		ActiveZone        string   `yaml:"active_zone"`
+		ActiveZoneOutline string   `yaml:"active_zone_outline"`
+		GoToTarget        string   `yaml:"go_to_target"`
+		Segments          []string `yaml:"segments"`
+		Label             string   `yaml:"label"`
+		LabelOutline      string   `yaml:"label_outline"`
+		Heatmap           []string `yaml:"heatmap"`
 	} `yaml:"colors"`
 }
 
 type Config struct {
-	Mqtt *MQTTConfig `yaml:"mqtt"`
-	HTTP *HTTPConfig `yaml:"http"`
-	Map  *MapConfig  `yaml:"map"`
+	Mqtt     *MQTTConfig    `yaml:"mqtt"`
+	HTTP     *HTTPConfig    `yaml:"http"`
+	Map      *MapConfig     `yaml:"map"`
+	History  *HistoryConfig `yaml:"history"`
+	Alerts   *AlertsConfig  `yaml:"alerts"`
+	MapDiff  *MapDiffConfig `yaml:"map_diff"`
+	StateDir string         `yaml:"state_dir"`
 }
 
 func NewConfig(configFile string) (*Config, error) {
@@ -82,7 +175,66 @@ func NewConfig(configFile string) (*Config, error) {
 		return nil, err
 	}
 
-	return setDefaultColors(c)
+	c, err = setDefaultColors(c)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err = setDefaultMap(c)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err = setDefaultHTTP(c)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err = setDefaultMQTT(c)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err = setDefaultHistory(c)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err = setDefaultAlerts(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return setDefaultMapDiff(c)
+}
+
+// Only map section is required (and used) for rendering maps offline.
+func NewRenderConfig(configFile string) (*Config, error) {
+	c := &Config{}
+
+	yamlFile, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(yamlFile, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Map == nil {
+		return nil, errors.New("missing map section")
+	}
+	if err := validateMap(c.Map); err != nil {
+		return nil, err
+	}
+
+	c, err = setDefaultColors(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return setDefaultMap(c)
 }
 
 func setDefaultColors(c *Config) (*Config, error) {
@@ -106,10 +258,187 @@ func setDefaultColors(c *Config) (*Config, error) {
 		c.Map.Colors.VirtualWall = "#ff0000bf"
 	}
 
+	if c.Map.Colors.NoMopArea == "" {
+		c.Map.Colors.NoMopArea = "#b000ff4a"
+	}
+
+	if c.Map.Colors.NoMopAreaOutline == "" {
+		c.Map.Colors.NoMopAreaOutline = "#b000ffbf"
+	}
+
+	if c.Map.Colors.ActiveZone == "" {
+		c.Map.Colors.ActiveZone = "#00ff0040"
+	}
+
+	if c.Map.Colors.ActiveZoneOutline == "" {
+		c.Map.Colors.ActiveZoneOutline = "#00c000bf"
+	}
+
+	if c.Map.Colors.GoToTarget == "" {
+		c.Map.Colors.GoToTarget = "#ffd700ff"
+	}
+
 	if len(c.Map.Colors.Segments) < 4 {
 		c.Map.Colors.Segments = []string{"#19a1a1ff", "#7ac037ff", "#ff9b57ff", "#f7c841ff"}
 	}
 
+	if c.Map.Colors.Label == "" {
+		c.Map.Colors.Label = "#ffffffff"
+	}
+
+	if c.Map.Colors.LabelOutline == "" {
+		c.Map.Colors.LabelOutline = "#000000bf"
+	}
+
+	if len(c.Map.Colors.Heatmap) == 0 {
+		c.Map.Colors.Heatmap = []string{"#ffff0080", "#ff8000a0", "#ff0000c0"}
+	}
+
+	if c.Map.Colors.ObstacleMarker == "" {
+		c.Map.Colors.ObstacleMarker = "#ff00ffff"
+	}
+
+	for i := range c.Map.Obstacles.Markers {
+		if c.Map.Obstacles.Markers[i].Color == "" {
+			c.Map.Obstacles.Markers[i].Color = c.Map.Colors.ObstacleMarker
+		}
+	}
+
+	return c, nil
+}
+
+func setDefaultMap(c *Config) (*Config, error) {
+	if c.Map.Labels.Size == 0 {
+		c.Map.Labels.Size = 14
+	}
+
+	if c.Map.Labels.OutlineWidth == nil {
+		outlineWidth := 2
+		c.Map.Labels.OutlineWidth = &outlineWidth
+	}
+
+	if c.Map.Labels.Position == "" {
+		c.Map.Labels.Position = "center"
+	}
+
+	if c.Map.RobotSegmentTolerance == nil {
+		tolerance := 50
+		c.Map.RobotSegmentTolerance = &tolerance
+	}
+
+	if c.Map.BrushWidth == 0 {
+		c.Map.BrushWidth = 25
+	}
+
+	if c.Map.Heatmap.Mode == "" {
+		c.Map.Heatmap.Mode = "overlay"
+	}
+
+	if c.Map.Heatmap.MaxPasses == 0 {
+		c.Map.Heatmap.MaxPasses = 3
+	}
+
+	if c.Map.Obstacles.Labels == nil {
+		obstacleLabels := true
+		c.Map.Obstacles.Labels = &obstacleLabels
+	}
+
+	if c.Map.Obstacles.LabelSize == 0 {
+		c.Map.Obstacles.LabelSize = 10
+	}
+
+	return c, nil
+}
+
+func setDefaultHTTP(c *Config) (*Config, error) {
+	if c.HTTP.MJPEG.Quality == 0 {
+		c.HTTP.MJPEG.Quality = 75
+	}
+
+	if c.HTTP.MJPEG.KeepAliveInt == 0 {
+		c.HTTP.MJPEG.KeepAliveInt = 10 * time.Second
+	}
+
+	if c.HTTP.MJPEG.Background == "" {
+		c.HTTP.MJPEG.Background = "#e0e0e0"
+	}
+
+	return c, nil
+}
+
+func setDefaultMQTT(c *Config) (*Config, error) {
+	if c.Mqtt.HaMapEntity == "" {
+		c.Mqtt.HaMapEntity = "camera"
+	}
+
+	return c, nil
+}
+
+func setDefaultHistory(c *Config) (*Config, error) {
+	if c.History == nil || !c.History.Enabled {
+		return c, nil
+	}
+
+	if c.History.DockDistance == 0 {
+		c.History.DockDistance = 50
+	}
+
+	if c.History.Timelapse.FrameRate == 0 {
+		c.History.Timelapse.FrameRate = 10
+	}
+
+	if c.History.Timelapse.MaxFrames == 0 {
+		c.History.Timelapse.MaxFrames = 100
+	}
+
+	return c, nil
+}
+
+func setDefaultAlerts(c *Config) (*Config, error) {
+	if c.Alerts == nil || !c.Alerts.Enabled {
+		return c, nil
+	}
+
+	if c.Alerts.StuckTime == 0 {
+		c.Alerts.StuckTime = 5 * time.Minute
+	}
+
+	if c.Alerts.StuckDistance == 0 {
+		c.Alerts.StuckDistance = 30
+	}
+
+	if c.Alerts.DockDistance == 0 {
+		c.Alerts.DockDistance = 50
+	}
+
+	return c, nil
+}
+
+func setDefaultMapDiff(c *Config) (*Config, error) {
+	if c.MapDiff == nil || !c.MapDiff.Enabled {
+		return c, nil
+	}
+
+	if c.MapDiff.Colors.Floor == "" {
+		c.MapDiff.Colors.Floor = "#c0c0c0ff"
+	}
+
+	if c.MapDiff.Colors.Wall == "" {
+		c.MapDiff.Colors.Wall = "#5d5d5dff"
+	}
+
+	if c.MapDiff.Colors.FloorAdded == "" {
+		c.MapDiff.Colors.FloorAdded = "#00c000ff"
+	}
+
+	if c.MapDiff.Colors.FloorRemoved == "" {
+		c.MapDiff.Colors.FloorRemoved = "#ff9b00ff"
+	}
+
+	if c.MapDiff.Colors.WallAdded == "" {
+		c.MapDiff.Colors.WallAdded = "#ff0000ff"
+	}
+
 	return c, nil
 }
 
@@ -142,12 +471,89 @@ func validate(c *Config) (*Config, error) {
 		return nil, errors.New("missing mqtt.topics.ha_autoconf_prefix value")
 	}
 
-	// Check map section
-	if c.Map.Scale < 1 {
-		return nil, errors.New("missing map.scale cannot be lower than 1")
+	// Check Home Assistant map entity
+	switch c.Mqtt.HaMapEntity {
+	case "", "camera", "image":
+	case "image_url":
+		if c.Mqtt.ImageURL == "" {
+			return nil, errors.New("missing mqtt.image_url value")
+		}
+		if !c.HTTP.Enabled {
+			return nil, errors.New("mqtt.ha_map_entity image_url requires http.enabled")
+		}
+	default:
+		return nil, errors.New("invalid mqtt.ha_map_entity value")
 	}
-	if c.Map.PNGCompression < 0 || c.Map.PNGCompression > 3 {
-		return nil, errors.New("invalid map.png_compression value")
+
+	// Check MQTT record section
+	if c.Mqtt.Record != nil && c.Mqtt.Record.Enabled {
+		if c.Mqtt.Record.Dir == "" {
+			return nil, errors.New("missing mqtt.record.dir value")
+		}
+		if c.Mqtt.Record.MaxFileSizeMB < 1 {
+			return nil, errors.New("mqtt.record.max_file_size_mb cannot be lower than 1")
+		}
+		if c.Mqtt.Record.MaxFiles < 1 {
+			return nil, errors.New("mqtt.record.max_files cannot be lower than 1")
+		}
+	}
+
+	// Check http section
+	if c.HTTP.MJPEG.Quality < 0 || c.HTTP.MJPEG.Quality > 100 {
+		return nil, errors.New("invalid http.mjpeg.quality value")
+	}
+	if c.HTTP.MJPEG.KeepAliveInt < 0 {
+		return nil, errors.New("http.mjpeg.keep_alive_int cannot be negative")
+	}
+
+	// Check history section
+	if c.History != nil && c.History.Enabled {
+		if c.History.Dir == "" {
+			return nil, errors.New("missing history.dir value")
+		}
+		if c.History.MaxSessions < 1 {
+			return nil, errors.New("history.max_sessions cannot be lower than 1")
+		}
+		if c.History.DockDistance < 0 {
+			return nil, errors.New("history.dock_distance cannot be negative")
+		}
+		if c.History.Timelapse.FrameRate < 0 {
+			return nil, errors.New("history.timelapse.fps cannot be negative")
+		}
+		if c.History.Timelapse.MaxFrames < 0 {
+			return nil, errors.New("history.timelapse.max_frames cannot be negative")
+		}
+		if c.History.Timelapse.Scale != 0 && c.History.Timelapse.Scale < 1 {
+			return nil, errors.New("history.timelapse.scale cannot be lower than 1")
+		}
+	}
+
+	// Check alerts section
+	if c.Alerts != nil && c.Alerts.Enabled {
+		if c.Alerts.StuckTime < 0 {
+			return nil, errors.New("alerts.stuck_time cannot be negative")
+		}
+		if c.Alerts.StuckDistance < 0 {
+			return nil, errors.New("alerts.stuck_distance cannot be negative")
+		}
+		if c.Alerts.DockDistance < 0 {
+			return nil, errors.New("alerts.dock_distance cannot be negative")
+		}
+	}
+
+	// Check map_diff section
+	if c.MapDiff != nil && c.MapDiff.Enabled {
+		if c.MapDiff.Reference == "" {
+			return nil, errors.New("missing map_diff.reference value")
+		}
+		if c.MapDiff.MinArea < 0 {
+			return nil, errors.New("map_diff.min_area cannot be negative")
+		}
+	}
+
+	// Check map section
+	if err := validateMap(c.Map); err != nil {
+		return nil, err
 	}
 
 	// Everything else should fail when used (e.g. wrong IP/port will cause
@@ -155,3 +561,57 @@ func validate(c *Config) (*Config, error) {
 
 	return c, nil
 }
+
+func validateMap(m *MapConfig) error {
+	if m.Scale < 1 {
+		return errors.New("missing map.scale cannot be lower than 1")
+	}
+	if m.PNGCompression < 0 || m.PNGCompression > 3 {
+		return errors.New("invalid map.png_compression value")
+	}
+	if m.Labels.Position != "" && m.Labels.Position != "center" && m.Labels.Position != "inscribed" {
+		return errors.New("invalid map.labels.position value")
+	}
+	if m.BrushWidth < 0 {
+		return errors.New("map.brush_width cannot be negative")
+	}
+	if m.RobotSegmentTolerance != nil && *m.RobotSegmentTolerance < 0 {
+		return errors.New("map.robot_segment_tolerance cannot be negative")
+	}
+	if m.Heatmap.Mode != "" && m.Heatmap.Mode != "overlay" && m.Heatmap.Mode != "replace" {
+		return errors.New("invalid map.heatmap.mode value")
+	}
+	if m.Heatmap.MaxPasses < 0 {
+		return errors.New("map.heatmap.max_passes cannot be negative")
+	}
+	if m.Labels.Size < 0 {
+		return errors.New("map.labels.size cannot be negative")
+	}
+	if m.Labels.OutlineWidth != nil && *m.Labels.OutlineWidth < 0 {
+		return errors.New("map.labels.outline_width cannot be negative")
+	}
+	if m.Obstacles.LabelSize < 0 {
+		return errors.New("map.obstacles.label_size cannot be negative")
+	}
+	if m.Obstacles.MinConfidence < 0 || m.Obstacles.MinConfidence > 100 {
+		return errors.New("invalid map.obstacles.min_confidence value")
+	}
+	for _, marker := range m.Obstacles.Markers {
+		if marker.Class == "" {
+			return errors.New("missing map.obstacles.markers.class value")
+		}
+		if !m.Obstacles.Hide && marker.Icon != "" {
+			if _, err := os.Stat(marker.Icon); err != nil {
+				return errors.New("unable to access map.obstacles.markers.icon file: " + err.Error())
+			}
+		}
+	}
+	obstacleLabels := m.Obstacles.Labels == nil || *m.Obstacles.Labels
+	if (m.Labels.Enabled || (!m.Obstacles.Hide && obstacleLabels)) && m.Labels.Font != "" {
+		if _, err := os.Stat(m.Labels.Font); err != nil {
+			return errors.New("unable to access map.labels.font file: " + err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRenderConfigDefaults(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           string
+		tolerance      int
+		outlineWidth   int
+		obstacleLabels bool
+	}{
+		{"defaults", "map:\n  scale: 1\n", 50, 2, true},
+		{"explicit zero", "map:\n  scale: 1\n  robot_segment_tolerance: 0\n  labels:\n    outline_width: 0\n  obstacles:\n    labels: false\n", 0, 0, false},
+		{"explicit value", "map:\n  scale: 1\n  robot_segment_tolerance: 10\n  labels:\n    outline_width: 3\n  obstacles:\n    labels: true\n", 10, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewRenderConfig(writeConfig(t, tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := *c.Map.RobotSegmentTolerance; got != tt.tolerance {
+				t.Errorf("robot_segment_tolerance = %d, want %d", got, tt.tolerance)
+			}
+			if got := *c.Map.Labels.OutlineWidth; got != tt.outlineWidth {
+				t.Errorf("labels.outline_width = %d, want %d", got, tt.outlineWidth)
+			}
+			if got := *c.Map.Obstacles.Labels; got != tt.obstacleLabels {
+				t.Errorf("obstacles.labels = %v, want %v", got, tt.obstacleLabels)
+			}
+		})
+	}
+}
+
+func TestRenderConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"negative tolerance", "map:\n  scale: 1\n  robot_segment_tolerance: -1\n"},
+		{"negative outline width", "map:\n  scale: 1\n  labels:\n    outline_width: -1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRenderConfig(writeConfig(t, tt.data)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestConfigImageURL(t *testing.T) {
+	base := "mqtt:\n  connection: {}\n  topics:\n    valetudo_prefix: valetudo\n    valetudo_identifier: robot\n    ha_autoconf_prefix: homeassistant\n  ha_map_entity: image_url\n  image_url: http://127.0.0.1:3000/api/map/image\nmap:\n  scale: 1\n"
+	tests := []struct {
+		name    string
+		http    string
+		wantErr bool
+	}{
+		{"http enabled", "http:\n  enabled: true\n", false},
+		{"http disabled", "http:\n  enabled: false\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewConfig(writeConfig(t, base+tt.http))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Package history detects cleaning sessions from consecutive maps and keeps a
+// record of every finished one on disk.
+//
+// Store is a directory, where every session is kept as "<id>.json" file with
+// session details, "<id>.png" file with the last rendered image of the session and
+// optional "<id>.gif" file with time-lapse of the session.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
+)
+
+type Session struct {
+	ID           string             `json:"id"`
+	StartedAt    time.Time          `json:"started_at"`
+	EndedAt      time.Time          `json:"ended_at"`
+	Duration     int                `json:"duration"`      // Seconds
+	Distance     float64            `json:"distance"`      // m
+	AverageSpeed float64            `json:"average_speed"` // m/s
+	Area         float64            `json:"area"`          // m², that robot's path has passed over
+	Segments     []*SessionSegment  `json:"segments"`      // Segments (rooms) robot has been in
+	Path         [][]*mapinfo.Point `json:"path,omitempty"`
+
+	// Decoded map payloads received during the session, evenly spread (only if
+	// requested from Tracker)
+	Payloads [][]byte `json:"-"`
+}
+
+type SessionSegment struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Coverage float64 `json:"coverage"` // %
+}
+
+type Store struct {
+	mux         sync.RWMutex
+	dir         string
+	maxSessions int
+	sessions    []*Session // Sorted by start time, without paths
+}
+
+// Opens the store, creating given directory if needed. Oldest sessions are removed
+// once there are more than maxSessions.
+func NewStore(dir string, maxSessions int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	st := &Store{
+		dir:         dir,
+		maxSessions: maxSessions,
+		sessions:    make([]*Session, 0),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		s, err := st.readSession(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		s.Path = nil
+		st.sessions = append(st.sessions, s)
+	}
+	sort.Slice(st.sessions, func(i, j int) bool {
+		return st.sessions[i].StartedAt.Before(st.sessions[j].StartedAt)
+	})
+	return st, nil
+}
+
+// Saves finished session together with its image.
+func (st *Store) Save(s *Session, img []byte) error {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(st.dir, s.ID+".png"), img, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(st.dir, s.ID+".json"), data, 0o644); err != nil {
+		return err
+	}
+
+	listed := *s
+	listed.Path, listed.Payloads = nil, nil
+	st.sessions = append(st.sessions, &listed)
+
+	for len(st.sessions) > st.maxSessions && st.maxSessions > 0 {
+		id := st.sessions[0].ID
+		if err := os.Remove(filepath.Join(st.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Remove(filepath.Join(st.dir, id+".png")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Remove(filepath.Join(st.dir, id+".gif")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		st.sessions = st.sessions[1:]
+	}
+	return nil
+}
+
+// Returns all sessions (without paths), newest first.
+func (st *Store) List() []*Session {
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	sessions := make([]*Session, 0, len(st.sessions))
+	for i := len(st.sessions) - 1; i >= 0; i-- {
+		sessions = append(sessions, st.sessions[i])
+	}
+	return sessions
+}
+
+// Returns session (with path) by ID.
+func (st *Store) Get(id string) (*Session, error) {
+	if !st.exists(id) {
+		return nil, os.ErrNotExist
+	}
+	return st.readSession(id)
+}
+
+// Returns image of the session by ID.
+func (st *Store) Image(id string) ([]byte, error) {
+	if !st.exists(id) {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(st.dir, id+".png"))
+}
+
+// Saves time-lapse (animated GIF) of already saved session.
+func (st *Store) SaveTimelapse(id string, gif []byte) error {
+	if !st.exists(id) {
+		return os.ErrNotExist
+	}
+	return os.WriteFile(filepath.Join(st.dir, id+".gif"), gif, 0o644)
+}
+
+// Returns time-lapse (animated GIF) of the session by ID.
+func (st *Store) Timelapse(id string) ([]byte, error) {
+	if !st.exists(id) {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(st.dir, id+".gif"))
+}
+
+// Only known IDs are accepted, so they are safe to use in file paths
+func (st *Store) exists(id string) bool {
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	for _, s := range st.sessions {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *Store) readSession(id string) (*Session, error) {
+	data, err := os.ReadFile(filepath.Join(st.dir, id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var s *Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, errors.New(id + ": " + err.Error())
+	}
+	return s, nil
+}
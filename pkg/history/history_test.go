@@ -0,0 +1,179 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+var charger = &mapinfo.Position{Point: mapinfo.Point{X: 1000, Y: 1000}}
+
+// Returns map with robot at given position and path of given points
+func testMap(at time.Time, robotX, robotY int, path ...int) (*mapinfo.MapInfo, *renderer.ValetudoJSON) {
+	mi := &mapinfo.MapInfo{
+		RenderedAt: at,
+		Robot:      &mapinfo.Position{Point: mapinfo.Point{X: robotX, Y: robotY}},
+		Charger:    charger,
+		Segments: []*mapinfo.Segment{
+			{ID: "1", Name: "Kitchen", Area: 10, Coverage: 50},
+			{ID: "2", Name: "", Area: 5, Coverage: 0},
+		},
+	}
+	m := &renderer.ValetudoJSON{
+		Entities: []*renderer.Entity{{Type: "path", Points: path}},
+	}
+	return mi, m
+}
+
+func TestTracker(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tracker := NewTracker(50, 0)
+
+	steps := []struct {
+		robotX, robotY int
+		path           []int
+		finished       bool
+	}{
+		{1000, 1000, []int{1000, 1000}, false},             // Docked
+		{1300, 1000, []int{1000, 1000, 1300, 1000}, false}, // Left the charger
+		{1300, 1400, []int{1000, 1000, 1300, 1000, 1300, 1400}, false},
+		{1000, 1000, []int{1000, 1000, 1300, 1000, 1300, 1400, 1000, 1000}, true}, // Docked
+		{1000, 1000, []int{1000, 1000, 1300, 1000, 1300, 1400, 1000, 1000}, false},
+	}
+
+	var session *Session
+	for i, step := range steps {
+		mi, m := testMap(start.Add(time.Duration(i)*time.Minute), step.robotX, step.robotY, step.path...)
+		s, img := tracker.Update(mi, m, nil, []byte{byte(i)})
+		if (s != nil) != step.finished {
+			t.Fatalf("step %d: got finished session %v, want %v", i, s != nil, step.finished)
+		}
+		if s != nil {
+			session = s
+			if len(img) != 1 || img[0] != byte(i) {
+				t.Errorf("step %d: got image %v, want the last one", i, img)
+			}
+		}
+	}
+
+	if session.ID != "20240101T100100Z" || session.Duration != 120 {
+		t.Errorf("got session %s with duration %ds", session.ID, session.Duration)
+	}
+	if session.Distance != 3+4+5 || session.AverageSpeed != 0.1 {
+		t.Errorf("got distance %v and average speed %v", session.Distance, session.AverageSpeed)
+	}
+	if session.Area != 5 || len(session.Segments) != 1 || session.Segments[0].Name != "Kitchen" {
+		t.Errorf("got area %v and segments %v", session.Area, session.Segments)
+	}
+}
+
+func TestTrackerPayloads(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tracker := NewTracker(50, 4)
+
+	// Robot is away from the charger for 19 updates and docks with the 20th
+	path := []int{1000, 1000}
+	for i := 0; i < 20; i++ {
+		robotX := 1300
+		if i == 19 {
+			robotX = 1000
+		}
+		path = append(path, robotX, 1000+i)
+		mi, m := testMap(start.Add(time.Duration(i)*time.Minute), robotX, 1000, path...)
+		s, _ := tracker.Update(mi, m, []byte{byte(i)}, nil)
+
+		if tracker.active != nil && len(tracker.active.Payloads) > 4 {
+			t.Fatalf("step %d: got %d payloads kept", i, len(tracker.active.Payloads))
+		}
+		if i < 19 {
+			continue
+		}
+		if s == nil {
+			t.Fatal("got no finished session")
+		}
+
+		// 20 payloads are reduced to every 8th one
+		expected := []byte{0, 8, 16}
+		if len(s.Payloads) != len(expected) {
+			t.Fatalf("got %d payloads, want %d", len(s.Payloads), len(expected))
+		}
+		for j, p := range s.Payloads {
+			if p[0] != expected[j] {
+				t.Errorf("got payload %d, want %d", p[0], expected[j])
+			}
+		}
+	}
+}
+
+func TestTrackerPathReset(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tracker := NewTracker(50, 0)
+
+	// Without charger, session can only be detected from path reset
+	update := func(i int, path ...int) *Session {
+		mi, m := testMap(start.Add(time.Duration(i)*time.Minute), 0, 0, path...)
+		mi.Robot = nil
+		s, _ := tracker.Update(mi, m, nil, nil)
+		return s
+	}
+
+	if update(0, 0, 0, 100, 0) != nil || update(1) != nil || update(2, 0, 0) != nil || update(3, 0, 0, 200, 0) != nil {
+		t.Fatal("got finished session before path reset")
+	}
+	s := update(4, 500, 500)
+	if s == nil {
+		t.Fatal("got no finished session after path reset")
+	}
+	if s.Distance != 2 {
+		t.Errorf("got distance %v, want %v", s.Distance, 2)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	st, err := NewStore(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		s := &Session{
+			ID:        start.Add(time.Duration(i) * time.Hour).Format("20060102T150405Z"),
+			StartedAt: start.Add(time.Duration(i) * time.Hour),
+			Path:      [][]*mapinfo.Point{{{X: i, Y: i}}},
+		}
+		if err := st.Save(s, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reopen to make sure sessions are loaded from disk
+	st, err = NewStore(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := st.List()
+	if len(list) != 2 || list[0].ID != "20240101T120000Z" || list[1].ID != "20240101T110000Z" {
+		t.Fatalf("got sessions %v", list)
+	}
+	if list[0].Path != nil {
+		t.Error("got path within the list")
+	}
+
+	s, err := st.Get("20240101T120000Z")
+	if err != nil || len(s.Path) != 1 || s.Path[0][0].X != 2 {
+		t.Errorf("got session %v, error %v", s, err)
+	}
+	if img, err := st.Image("20240101T120000Z"); err != nil || len(img) != 1 || img[0] != 2 {
+		t.Errorf("got image %v, error %v", img, err)
+	}
+	if _, err := st.Get("20240101T100000Z"); err == nil {
+		t.Error("got removed session")
+	}
+	if _, err := st.Image("../../etc/passwd"); err == nil {
+		t.Error("got image of unknown session")
+	}
+}
@@ -0,0 +1,165 @@
+package history
+
+import (
+	"math"
+
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+// Detects cleaning sessions from consecutive maps. Session starts once robot
+// leaves the charger, or once path starts growing after it was reset. It ends
+// once robot returns to the charger, or once path is reset again.
+type Tracker struct {
+	dockDistance int // In robot's coordinates system units
+	maxPayloads  int
+
+	active     *Session
+	activeImg  []byte
+	leftDock   bool // Whether robot has left the charger during active session
+	pathPoints int  // Amount of path points within the previous map
+	pathReset  bool // Whether path was reset since the last session
+
+	payloadStride int // Only every payloadStride-th payload of active session is kept
+	payloadCount  int // Payloads received during active session
+}
+
+// Robot is considered docked if it's within dockDistance (in robot's coordinates
+// system units) from the charger. Up to maxPayloads (evenly spread) map payloads
+// are kept for every session, e.g. for time-lapse, 0 disables it.
+func NewTracker(dockDistance, maxPayloads int) *Tracker {
+	return &Tracker{
+		dockDistance: dockDistance,
+		maxPayloads:  maxPayloads,
+	}
+}
+
+// Processes newly rendered map and returns session (with its last image) if it
+// has just finished, or nil otherwise.
+func (t *Tracker) Update(mi *mapinfo.MapInfo, m *renderer.ValetudoJSON, payload, img []byte) (*Session, []byte) {
+	var finished *Session
+	var finishedImg []byte
+
+	path := getPath(m)
+	pathPoints := 0
+	for _, p := range path {
+		pathPoints += len(p)
+	}
+	docked := t.isDocked(mi)
+	reset := pathPoints < t.pathPoints
+	grown := pathPoints > t.pathPoints
+	t.pathPoints = pathPoints
+
+	// Previous map was the last one of the session
+	if reset {
+		if t.active != nil {
+			finished, finishedImg = t.finish()
+		}
+		t.pathReset = true
+	}
+
+	if t.active == nil && ((mi.Robot != nil && !docked) || (t.pathReset && grown)) {
+		t.active = &Session{
+			ID:        mi.RenderedAt.UTC().Format("20060102T150405Z"),
+			StartedAt: mi.RenderedAt,
+		}
+		t.pathReset = false
+		t.payloadStride, t.payloadCount = 1, 0
+	}
+	if t.active == nil {
+		return finished, finishedImg
+	}
+
+	t.update(mi, path, img)
+	t.addPayload(payload)
+	if !docked {
+		t.leftDock = true
+	} else if t.leftDock {
+		finished, finishedImg = t.finish()
+	}
+	return finished, finishedImg
+}
+
+func (t *Tracker) isDocked(mi *mapinfo.MapInfo) bool {
+	if mi.Robot == nil || mi.Charger == nil {
+		return false
+	}
+	dx, dy := float64(mi.Robot.X-mi.Charger.X), float64(mi.Robot.Y-mi.Charger.Y)
+	return math.Hypot(dx, dy) <= float64(t.dockDistance)
+}
+
+func (t *Tracker) update(mi *mapinfo.MapInfo, path [][]*mapinfo.Point, img []byte) {
+	s := t.active
+	s.EndedAt = mi.RenderedAt
+	s.Duration = int(s.EndedAt.Sub(s.StartedAt).Seconds())
+	s.Path = path
+	s.Distance = mapinfo.PathLength(path)
+	s.AverageSpeed = 0
+	if s.Duration > 0 {
+		s.AverageSpeed = math.Round(s.Distance/float64(s.Duration)*100) / 100
+	}
+
+	s.Area = 0
+	s.Segments = make([]*SessionSegment, 0)
+	for _, seg := range mi.Segments {
+		if seg.Coverage == 0 {
+			continue
+		}
+		s.Area += seg.Area * seg.Coverage / 100
+		s.Segments = append(s.Segments, &SessionSegment{
+			ID:       seg.ID,
+			Name:     seg.DisplayName(),
+			Coverage: seg.Coverage,
+		})
+	}
+	s.Area = math.Round(s.Area*100) / 100
+
+	t.activeImg = img
+}
+
+// Once there are more payloads than needed, every second one is dropped and
+// only every second one of the following payloads is kept, so there are never
+// more than maxPayloads of them and they stay evenly spread over the session.
+func (t *Tracker) addPayload(payload []byte) {
+	if t.maxPayloads <= 0 {
+		return
+	}
+	s := t.active
+	keep := t.payloadCount%t.payloadStride == 0
+	t.payloadCount++
+	if !keep {
+		return
+	}
+	s.Payloads = append(s.Payloads, payload)
+	if len(s.Payloads) > t.maxPayloads {
+		kept := s.Payloads[:0]
+		for i := 0; i < len(s.Payloads); i += 2 {
+			kept = append(kept, s.Payloads[i])
+		}
+		clear(s.Payloads[len(kept):]) // Let dropped payloads be garbage collected
+		s.Payloads = kept
+		t.payloadStride *= 2
+	}
+}
+
+func (t *Tracker) finish() (*Session, []byte) {
+	s, img := t.active, t.activeImg
+	t.active, t.activeImg, t.leftDock = nil, nil, false
+	return s, img
+}
+
+// Every path entity is returned as a separate line
+func getPath(m *renderer.ValetudoJSON) [][]*mapinfo.Point {
+	path := make([][]*mapinfo.Point, 0)
+	for _, e := range m.Entities {
+		if e.Type != "path" || len(e.Points) < 2 {
+			continue
+		}
+		points := make([]*mapinfo.Point, 0, len(e.Points)/2)
+		for i := 0; i+1 < len(e.Points); i += 2 {
+			points = append(points, &mapinfo.Point{X: e.Points[i], Y: e.Points[i+1]})
+		}
+		path = append(path, points)
+	}
+	return path
+}
@@ -0,0 +1,344 @@
+// Package mapdiff compares map against pinned reference map, e.g. to notice when
+// Valetudo has re-mapped the place or furniture was moved.
+package mapdiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+const (
+	SegmentAdded     = "added"
+	SegmentRemoved   = "removed"
+	SegmentIDChanged = "id_changed"
+	SegmentRenamed   = "renamed"
+)
+
+type Diff struct {
+	Changed      bool             `json:"changed"`  // Whether any change exceeds MinArea, or segments changed
+	Remapped     bool             `json:"remapped"` // Map nonce differs, so Valetudo has created a new map
+	FloorAdded   float64          `json:"floor_added"`
+	FloorRemoved float64          `json:"floor_removed"`
+	WallsAdded   float64          `json:"walls_added"`
+	WallsRemoved float64          `json:"walls_removed"`
+	Segments     []*SegmentChange `json:"segments"`
+
+	Image []byte `json:"-"` // PNG image, highlighting changes
+}
+
+type SegmentChange struct {
+	Change        string `json:"change"`
+	ID            string `json:"id,omitempty"`
+	Name          string `json:"name,omitempty"`
+	ReferenceID   string `json:"reference_id,omitempty"`
+	ReferenceName string `json:"reference_name,omitempty"`
+}
+
+type Settings struct {
+	MinArea       float64 // m², smaller floor and wall changes are considered noise
+	Scale         int
+	RotationTimes int
+
+	FloorColor        color.RGBA // Floor, which has not changed
+	WallColor         color.RGBA // Walls, which have not changed
+	FloorAddedColor   color.RGBA
+	FloorRemovedColor color.RGBA
+	WallAddedColor    color.RGBA
+}
+
+// Parses reference map from decoded map payload.
+func ParseReference(payload []byte) (*renderer.ValetudoJSON, error) {
+	m, err := renderer.ParseJSON(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference map: %w", err)
+	}
+	return m, nil
+}
+
+// Returns hash of everything Compare depends on - layers and map's nonce, but
+// not entities. It can be used to skip comparing maps with unchanged layers.
+func LayersHash(m *renderer.ValetudoJSON) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	writeInt := func(v int) {
+		binary.LittleEndian.PutUint64(buf, uint64(v))
+		h.Write(buf)
+	}
+	writeString := func(s string) {
+		writeInt(len(s))
+		h.Write([]byte(s))
+	}
+
+	writeInt(m.PixelSize)
+	if m.MetaData != nil {
+		writeString(m.MetaData.Nonce)
+	}
+	for _, l := range m.Layers {
+		writeString(l.Type)
+		writeString(l.MetaData.SegmentId)
+		writeString(l.MetaData.Name)
+		writeInt(len(l.CompressedPixels))
+		for _, v := range l.CompressedPixels {
+			writeInt(v)
+		}
+	}
+	return h.Sum64()
+}
+
+// Compares map against reference. Both maps must be of the same pixel size.
+func Compare(m, reference *renderer.ValetudoJSON, s *Settings) (*Diff, error) {
+	if m.PixelSize != reference.PixelSize {
+		return nil, errors.New("map pixel size differs from reference map")
+	}
+
+	g := newGrid(m, reference)
+	cur, ref := g.newLayers(m), g.newLayers(reference)
+
+	d := &Diff{
+		Remapped: m.MetaData != nil && reference.MetaData != nil && m.MetaData.Nonce != reference.MetaData.Nonce,
+		Segments: compareSegments(m, reference, cur, ref),
+	}
+
+	var floorAdded, floorRemoved, wallsAdded, wallsRemoved int
+	for i := range cur.floor {
+		switch {
+		case cur.floor[i] && !ref.floor[i]:
+			floorAdded++
+		case !cur.floor[i] && ref.floor[i]:
+			floorRemoved++
+		}
+		switch {
+		case cur.wall[i] && !ref.wall[i]:
+			wallsAdded++
+		case !cur.wall[i] && ref.wall[i]:
+			wallsRemoved++
+		}
+	}
+	pixelArea := float64(m.PixelSize*m.PixelSize) / 10000
+	d.FloorAdded = math.Round(float64(floorAdded)*pixelArea*100) / 100
+	d.FloorRemoved = math.Round(float64(floorRemoved)*pixelArea*100) / 100
+	d.WallsAdded = math.Round(float64(wallsAdded)*pixelArea*100) / 100
+	d.WallsRemoved = math.Round(float64(wallsRemoved)*pixelArea*100) / 100
+	d.Changed = len(d.Segments) > 0 || d.FloorAdded > s.MinArea || d.FloorRemoved > s.MinArea ||
+		d.WallsAdded > s.MinArea || d.WallsRemoved > s.MinArea
+
+	img, err := g.renderImage(cur, ref, s)
+	if err != nil {
+		return nil, err
+	}
+	d.Image = img
+	return d, nil
+}
+
+// Bounds of both maps (in layer coordinates), so their pixels can be compared
+type grid struct {
+	minX, minY    int
+	width, height int
+}
+
+// Pixels of a single map within grid. Segments are floor too.
+type gridLayers struct {
+	floor   []bool
+	wall    []bool
+	segment []int // Index of segment layer + 1, 0 if pixel is not within segment
+}
+
+func newGrid(maps ...*renderer.ValetudoJSON) *grid {
+	minX, minY := math.MaxInt32, math.MaxInt32
+	maxX, maxY := math.MinInt32, math.MinInt32
+	for _, m := range maps {
+		for _, l := range m.Layers {
+			minX, minY = min(minX, l.Dimensions.X.Min), min(minY, l.Dimensions.Y.Min)
+			maxX, maxY = max(maxX, l.Dimensions.X.Max), max(maxY, l.Dimensions.Y.Max)
+		}
+	}
+	if minX > maxX || minY > maxY {
+		return &grid{}
+	}
+	return &grid{minX, minY, maxX - minX + 1, maxY - minY + 1}
+}
+
+func (g *grid) newLayers(m *renderer.ValetudoJSON) *gridLayers {
+	gl := &gridLayers{
+		floor:   make([]bool, g.width*g.height),
+		wall:    make([]bool, g.width*g.height),
+		segment: make([]int, g.width*g.height),
+	}
+	segmentIndex := 0
+	for _, l := range m.Layers {
+		if l.Type == "segment" {
+			segmentIndex++
+		}
+		for i := 0; i+2 < len(l.CompressedPixels); i += 3 {
+			x, y, count := l.CompressedPixels[i]-g.minX, l.CompressedPixels[i+1]-g.minY, l.CompressedPixels[i+2]
+			if y < 0 || y >= g.height {
+				continue
+			}
+			for c := max(x, 0); c < min(x+count, g.width); c++ {
+				idx := y*g.width + c
+				switch l.Type {
+				case "floor":
+					gl.floor[idx] = true
+				case "wall":
+					gl.wall[idx] = true
+				case "segment":
+					gl.floor[idx] = true
+					gl.segment[idx] = segmentIndex
+				}
+			}
+		}
+	}
+	return gl
+}
+
+// Segments are matched by their pixels rather than IDs, as Valetudo may assign
+// new IDs after re-mapping. Segments match if most pixels of both overlap.
+func compareSegments(m, reference *renderer.ValetudoJSON, cur, ref *gridLayers) []*SegmentChange {
+	curSegments, refSegments := segmentLayers(m), segmentLayers(reference)
+
+	// Overlapping pixels of every current and reference segment pair
+	overlap := make(map[[2]int]int)
+	curPixels := make(map[int]int)
+	refPixels := make(map[int]int)
+	for i := range cur.segment {
+		if cur.segment[i] > 0 {
+			curPixels[cur.segment[i]]++
+		}
+		if ref.segment[i] > 0 {
+			refPixels[ref.segment[i]]++
+		}
+		if cur.segment[i] > 0 && ref.segment[i] > 0 {
+			overlap[[2]int{cur.segment[i], ref.segment[i]}]++
+		}
+	}
+
+	changes := make([]*SegmentChange, 0)
+	matched := make(map[int]bool)
+	for ci, c := range curSegments {
+		match := 0
+		for ri := range refSegments {
+			o := overlap[[2]int{ci + 1, ri + 1}]
+			if o*2 > curPixels[ci+1] && o*2 > refPixels[ri+1] {
+				match = ri + 1
+				break
+			}
+		}
+		if match == 0 {
+			changes = append(changes, &SegmentChange{Change: SegmentAdded, ID: c.MetaData.SegmentId, Name: c.MetaData.Name})
+			continue
+		}
+		matched[match] = true
+
+		r := refSegments[match-1]
+		change := &SegmentChange{
+			ID:            c.MetaData.SegmentId,
+			Name:          c.MetaData.Name,
+			ReferenceID:   r.MetaData.SegmentId,
+			ReferenceName: r.MetaData.Name,
+		}
+		switch {
+		case c.MetaData.SegmentId != r.MetaData.SegmentId:
+			change.Change = SegmentIDChanged
+		case c.MetaData.Name != r.MetaData.Name:
+			change.Change = SegmentRenamed
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	for ri, r := range refSegments {
+		if !matched[ri+1] {
+			changes = append(changes, &SegmentChange{Change: SegmentRemoved, ReferenceID: r.MetaData.SegmentId, ReferenceName: r.MetaData.Name})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return segmentSortKey(changes[i]) < segmentSortKey(changes[j])
+	})
+	return changes
+}
+
+func segmentLayers(m *renderer.ValetudoJSON) []*renderer.Layer {
+	layers := make([]*renderer.Layer, 0)
+	for _, l := range m.Layers {
+		if l.Type == "segment" {
+			layers = append(layers, l)
+		}
+	}
+	return layers
+}
+
+// Segment IDs are usually numbers
+func segmentSortKey(c *SegmentChange) string {
+	id := c.ID
+	if id == "" {
+		id = c.ReferenceID
+	}
+	if n, err := strconv.Atoi(id); err == nil {
+		return strconv.Itoa(n + 1e9)
+	}
+	return id
+}
+
+// Same rotation as the rendered map, so both images can be compared side by side
+func (g *grid) renderImage(cur, ref *gridLayers, s *Settings) ([]byte, error) {
+	width, height := g.width, g.height
+	if s.RotationTimes%2 != 0 {
+		width, height = height, width
+	}
+	scale := max(s.Scale, 1)
+	img := image.NewRGBA(image.Rect(0, 0, width*scale, height*scale))
+
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			i := y*g.width + x
+			var col color.RGBA
+			switch {
+			case cur.wall[i] && !ref.wall[i]:
+				col = s.WallAddedColor
+			case cur.wall[i]:
+				col = s.WallColor
+			case ref.floor[i] && !cur.floor[i]:
+				col = s.FloorRemovedColor
+			case cur.floor[i] && !ref.floor[i]:
+				col = s.FloorAddedColor
+			case cur.floor[i]:
+				col = s.FloorColor
+			default:
+				continue
+			}
+
+			rx, ry := x, y
+			switch s.RotationTimes {
+			case 1:
+				rx, ry = width-1-y, x
+			case 2:
+				rx, ry = width-1-x, height-1-y
+			case 3:
+				rx, ry = y, height-1-x
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetRGBA(rx*scale+dx, ry*scale+dy, col)
+				}
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,165 @@
+package mapdiff
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+func testSettings() *Settings {
+	return &Settings{
+		MinArea:           0.5,
+		Scale:             2,
+		FloorColor:        color.RGBA{0xc0, 0xc0, 0xc0, 0xff},
+		WallColor:         color.RGBA{0x5d, 0x5d, 0x5d, 0xff},
+		FloorAddedColor:   color.RGBA{0x00, 0xc0, 0x00, 0xff},
+		FloorRemovedColor: color.RGBA{0xff, 0x9b, 0x00, 0xff},
+		WallAddedColor:    color.RGBA{0xff, 0x00, 0x00, 0xff},
+	}
+}
+
+func readTestMap(t *testing.T) *renderer.ValetudoJSON {
+	t.Helper()
+	data, err := os.ReadFile("../renderer/testdata/map.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseReference(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestCompareUnchanged(t *testing.T) {
+	d, err := Compare(readTestMap(t), readTestMap(t), testSettings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Changed || d.Remapped || d.FloorAdded != 0 || d.FloorRemoved != 0 || d.WallsAdded != 0 || d.WallsRemoved != 0 || len(d.Segments) != 0 {
+		t.Errorf("got changes %+v", d)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	reference := readTestMap(t)
+	m := readTestMap(t)
+	m.MetaData.Nonce = "00000000"
+
+	layers := make([]*renderer.Layer, 0)
+	for _, l := range m.Layers {
+		switch l.MetaData.SegmentId {
+		case "1":
+			l.MetaData.Name = "Dining room"
+		case "2":
+			l.MetaData.SegmentId = "7"
+		case "3":
+			continue // Vanished floor (6x19 pixels of 5x5cm)
+		}
+		layers = append(layers, l)
+	}
+
+	// New wall of 40 pixels (of 5x5cm) in the middle of the living room
+	layers = append(layers, &renderer.Layer{
+		Type:             "wall",
+		Dimensions:       renderer.Dimensions{X: renderer.Dimension{Min: 450, Max: 489}, Y: renderer.Dimension{Min: 440, Max: 440}},
+		CompressedPixels: []int{450, 440, 40},
+	})
+	m.Layers = layers
+
+	s := testSettings()
+	s.RotationTimes = 1
+	d, err := Compare(m, reference, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !d.Changed || !d.Remapped {
+		t.Errorf("got changed %v, remapped %v", d.Changed, d.Remapped)
+	}
+	if d.FloorAdded != 0 || d.FloorRemoved != 1.43 || d.WallsAdded != 0.1 || d.WallsRemoved != 0 {
+		t.Errorf("got floor +%v -%v, walls +%v -%v", d.FloorAdded, d.FloorRemoved, d.WallsAdded, d.WallsRemoved)
+	}
+
+	expected := []*SegmentChange{
+		{Change: SegmentRenamed, ID: "1", Name: "Dining room", ReferenceID: "1", ReferenceName: "Kitchen"},
+		{Change: SegmentRemoved, ReferenceID: "3"},
+		{Change: SegmentIDChanged, ID: "7", Name: "Living room", ReferenceID: "2", ReferenceName: "Living room"},
+	}
+	if !reflect.DeepEqual(d.Segments, expected) {
+		for _, c := range d.Segments {
+			t.Logf("%+v", *c)
+		}
+		t.Error("got unexpected segment changes")
+	}
+
+	img, err := png.Decode(bytes.NewReader(d.Image))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Map is rotated, so width comes from the height of both maps
+	width := (reference.Layers[1].Dimensions.Y.Max - reference.Layers[1].Dimensions.Y.Min + 1) * s.Scale
+	if img.Bounds().Dx() != width {
+		t.Errorf("got image width %d, want %d", img.Bounds().Dx(), width)
+	}
+	if !hasColor(img, s.WallAddedColor) || !hasColor(img, s.FloorRemovedColor) || hasColor(img, s.FloorAddedColor) {
+		t.Error("got wrong highlighted changes")
+	}
+}
+
+func hasColor(img interface {
+	At(x, y int) color.Color
+	Bounds() image.Rectangle
+}, col color.RGBA) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.RGBAModel.Convert(img.At(x, y)) == col {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestComparePixelSize(t *testing.T) {
+	m := readTestMap(t)
+	m.PixelSize = 10
+	if _, err := Compare(m, readTestMap(t), testSettings()); err == nil {
+		t.Error("got no error for different pixel size")
+	}
+}
+
+func TestLayersHash(t *testing.T) {
+	m := readTestMap(t)
+	hash := LayersHash(m)
+
+	m.Entities = m.Entities[:1]
+	if LayersHash(m) != hash {
+		t.Error("got different hash for changed entities")
+	}
+
+	m.Layers[1].CompressedPixels[2]++
+	if LayersHash(m) == hash {
+		t.Error("got same hash for changed layer pixels")
+	}
+	m.Layers[1].CompressedPixels[2]--
+
+	m.Layers[2].MetaData.Name = "Dining room"
+	if LayersHash(m) == hash {
+		t.Error("got same hash for renamed segment")
+	}
+	m.Layers[2].MetaData.Name = "Kitchen"
+
+	m.MetaData.Nonce = "00000000"
+	if LayersHash(m) == hash {
+		t.Error("got same hash for changed nonce")
+	}
+}
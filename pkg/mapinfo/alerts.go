@@ -0,0 +1,127 @@
+package mapinfo
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	AlertStuck           = "stuck"
+	AlertOutsideSegments = "outside_segments"
+	AlertInNoGoArea      = "in_no_go_area"
+)
+
+type Alert struct {
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+type AlertSettings struct {
+	// Robot is considered stuck if it stays within StuckDistance (in robot's
+	// coordinates system units) for StuckTime, while its path keeps growing
+	StuckTime     time.Duration
+	StuckDistance int
+
+	// Charger is often placed outside of segments, so robot within DockDistance
+	// (in robot's coordinates system units) from it is never outside of segments
+	DockDistance int
+}
+
+// Detects problems with robot by comparing consecutive maps.
+type AlertDetector struct {
+	s      *AlertSettings
+	active map[string]*Alert
+
+	// Position where robot was first seen, while it stayed within StuckDistance
+	anchor           *Point
+	anchorAt         time.Time
+	anchorPathLength float64
+}
+
+func NewAlertDetector(s *AlertSettings) *AlertDetector {
+	return &AlertDetector{
+		s:      s,
+		active: make(map[string]*Alert),
+	}
+}
+
+// Returns currently active alerts, sorted by type. Alert keeps the time it was
+// first raised while it stays active.
+func (d *AlertDetector) Update(mi *MapInfo) []*Alert {
+	messages := make(map[string]string)
+	if d.isStuck(mi) {
+		messages[AlertStuck] = "Robot has not moved for " + d.s.StuckTime.String() + ", while its path keeps growing"
+	}
+	if mi.Robot != nil && len(mi.Segments) > 0 && mi.RobotSegment == nil && !d.isDocked(mi) {
+		messages[AlertOutsideSegments] = "Robot is outside of every segment"
+	}
+	if mi.Robot != nil {
+		for _, area := range mi.NoGoAreas {
+			if isPointInPolygon(&mi.Robot.Point, area) {
+				messages[AlertInNoGoArea] = "Robot is inside no-go area"
+				break
+			}
+		}
+	}
+
+	for alertType := range d.active {
+		if _, found := messages[alertType]; !found {
+			delete(d.active, alertType)
+		}
+	}
+	alerts := make([]*Alert, 0, len(messages))
+	for alertType, message := range messages {
+		a, found := d.active[alertType]
+		if !found {
+			a = &Alert{Type: alertType, Since: mi.RenderedAt}
+			d.active[alertType] = a
+		}
+		a.Message = message
+		alerts = append(alerts, a)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Type < alerts[j].Type
+	})
+	return alerts
+}
+
+func (d *AlertDetector) isStuck(mi *MapInfo) bool {
+	if mi.Robot == nil {
+		d.anchor = nil
+		return false
+	}
+
+	// Robot has moved away, or path was reset (new cleaning)
+	if d.anchor == nil || mi.PathLength < d.anchorPathLength ||
+		math.Hypot(float64(mi.Robot.X-d.anchor.X), float64(mi.Robot.Y-d.anchor.Y)) > float64(d.s.StuckDistance) {
+		robot := mi.Robot.Point
+		d.anchor = &robot
+		d.anchorAt = mi.RenderedAt
+		d.anchorPathLength = mi.PathLength
+		return false
+	}
+
+	return mi.RenderedAt.Sub(d.anchorAt) >= d.s.StuckTime && mi.PathLength > d.anchorPathLength
+}
+
+func (d *AlertDetector) isDocked(mi *MapInfo) bool {
+	if mi.Charger == nil {
+		return false
+	}
+	return math.Hypot(float64(mi.Robot.X-mi.Charger.X), float64(mi.Robot.Y-mi.Charger.Y)) <= float64(d.s.DockDistance)
+}
+
+// Ray casting algorithm
+func isPointInPolygon(p *Point, polygon []*Point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) &&
+			float64(p.X) < float64(b.X-a.X)*float64(p.Y-a.Y)/float64(b.Y-a.Y)+float64(a.X) {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,51 @@
+package mapinfo
+
+import (
+	"math"
+
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+// Sets percentage of every segment's pixels (and all segments' pixels in total)
+// that robot's path has passed over.
+func setCoverage(mi *MapInfo, m *renderer.ValetudoJSON, brushWidth int) {
+	passes := renderer.CountPasses(m, brushWidth)
+
+	segments := make(map[string]*Segment, len(mi.Segments))
+	for _, s := range mi.Segments {
+		segments[s.ID] = s
+	}
+
+	var totalPixels, totalCovered int
+	for _, l := range m.Layers {
+		if l.Type != "segment" {
+			continue
+		}
+
+		var pixels, covered int
+		for i := 0; i+2 < len(l.CompressedPixels); i += 3 {
+			x, y, count := l.CompressedPixels[i], l.CompressedPixels[i+1], l.CompressedPixels[i+2]
+			for c := 0; c < count; c++ {
+				if passes.At(x+c, y) > 0 {
+					covered++
+				}
+			}
+			pixels += max(count, 0)
+		}
+		totalPixels += pixels
+		totalCovered += covered
+
+		if s, found := segments[l.MetaData.SegmentId]; found {
+			s.Coverage = percentage(covered, pixels)
+		}
+	}
+	mi.Coverage = percentage(totalCovered, totalPixels)
+}
+
+// Rounded to 1 decimal place
+func percentage(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*1000) / 10
+}
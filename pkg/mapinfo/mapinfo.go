@@ -0,0 +1,105 @@
+package mapinfo
+
+import (
+	"time"
+
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+// Details about the map, extracted from every rendered map for publishing. All
+// coordinates are within robot's coordinates system.
+type MapInfo struct {
+	RenderedAt   time.Time  `json:"rendered_at"`
+	Version      int        `json:"version"`
+	Nonce        string     `json:"nonce"`
+	TotalArea    float64    `json:"total_area"` // m²
+	Coverage     float64    `json:"coverage"`   // % of all segments, that robot's path has passed over
+	Robot        *Position  `json:"robot"`
+	Charger      *Position  `json:"charger"`
+	Segments     []*Segment `json:"segments"` // Sorted by ID
+	NoGoAreas    [][]*Point `json:"no_go_areas"`
+	VirtualWalls [][]*Point `json:"virtual_walls"`
+	RobotSegment *Segment   `json:"robot_segment"` // Segment robot is currently in
+	PathLength   float64    `json:"path_length"`   // m
+
+	// Set by Odometer and AlertDetector, as they depend on previous maps
+	Travel *Travel  `json:"travel,omitempty"`
+	Alerts []*Alert `json:"alerts,omitempty"`
+}
+
+// Settings for extracting map details
+type Settings struct {
+	// Max distance from robot to the nearest segment, when robot is outside of
+	// every segment (in robot's coordinates system units, which is cm)
+	RobotSegmentTolerance int
+
+	// Width of the area robot cleans while moving along the path (in robot's
+	// coordinates system units)
+	BrushWidth int
+}
+
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Position struct {
+	Point
+	Angle float64 `json:"angle"`
+}
+
+func New(m *renderer.ValetudoJSON, renderedAt time.Time, s *Settings) *MapInfo {
+	mi := &MapInfo{
+		RenderedAt:   renderedAt,
+		Segments:     getSegments(m),
+		NoGoAreas:    getEntityPoints(m, "no_go_area"),
+		VirtualWalls: getEntityPoints(m, "virtual_wall"),
+		Robot:        getEntityPosition(m, "robot_position"),
+		Charger:      getEntityPosition(m, "charger_location"),
+	}
+	if m.MetaData != nil {
+		mi.Version = m.MetaData.Version
+		mi.Nonce = m.MetaData.Nonce
+		mi.TotalArea = areaToSquareMeters(m.MetaData.TotalLayerArea)
+	}
+	// Entity coordinates are already in robot's coordinates system units (cm),
+	// so unlike layers they don't need to be scaled by pixel size
+	mi.PathLength = PathLength(getEntityPoints(m, "path"))
+	setCoverage(mi, m, s.BrushWidth)
+	mi.RobotSegment = findRobotSegment(m, mi.Robot, mi.Segments, s.RobotSegmentTolerance)
+	return mi
+}
+
+// Valetudo reports areas in cm²
+func areaToSquareMeters(area int) float64 {
+	return float64(area) / 10000
+}
+
+// Returns position of the first entity of given type, or nil if there is none
+func getEntityPosition(m *renderer.ValetudoJSON, entityType string) *Position {
+	for _, e := range m.Entities {
+		if e.Type != entityType || len(e.Points) < 2 {
+			continue
+		}
+		return &Position{
+			Point: Point{e.Points[0], e.Points[1]},
+			Angle: e.MetaData.Angle,
+		}
+	}
+	return nil
+}
+
+func getEntityPoints(m *renderer.ValetudoJSON, entityType string) [][]*Point {
+	entities := make([][]*Point, 0)
+	for _, e := range m.Entities {
+		if e.Type != entityType {
+			continue
+		}
+		points := make([]*Point, 0, len(e.Points)/2)
+		for i := 0; i+1 < len(e.Points); i += 2 {
+			points = append(points, &Point{e.Points[i], e.Points[i+1]})
+		}
+		entities = append(entities, points)
+	}
+	return entities
+}
@@ -0,0 +1,196 @@
+package mapinfo
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+func readTestMap(t *testing.T) *renderer.ValetudoJSON {
+	t.Helper()
+	data, err := os.ReadFile("../renderer/testdata/map.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m *renderer.ValetudoJSON
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSegments(t *testing.T) {
+	mi := New(readTestMap(t), time.Time{}, &Settings{})
+
+	expected := []Segment{
+		{ID: "1", Name: "Kitchen", Area: 2.25, Active: false, BoundingBox: &BoundingBox{2050, 2050, 2200, 2200}},
+		{ID: "2", Name: "Living room", Area: 5.85, Active: true, BoundingBox: &BoundingBox{2205, 2050, 2450, 2350}},
+		{ID: "3", Name: "", Area: 1.425, Active: false, BoundingBox: &BoundingBox{2050, 2205, 2200, 2300}},
+	}
+	if len(mi.Segments) != len(expected) {
+		t.Fatalf("got %d segments, want %d", len(mi.Segments), len(expected))
+	}
+	for i, s := range mi.Segments {
+		if s.ID != expected[i].ID || s.Name != expected[i].Name || s.Area != expected[i].Area || s.Active != expected[i].Active {
+			t.Errorf("segment %d: got %+v, want %+v", i, *s, expected[i])
+		}
+		if *s.BoundingBox != *expected[i].BoundingBox {
+			t.Errorf("segment %d: got bounding box %+v, want %+v", i, *s.BoundingBox, *expected[i].BoundingBox)
+		}
+	}
+
+	if name := mi.Segments[2].DisplayName(); name != "Segment 3" {
+		t.Errorf("got display name %q, want %q", name, "Segment 3")
+	}
+	if mi.TotalArea <= 0 {
+		t.Errorf("got total area %v, want positive value", mi.TotalArea)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	mi := New(readTestMap(t), time.Time{}, &Settings{})
+
+	if mi.Version != 2 || mi.Nonce != "1f2e3d4c" {
+		t.Errorf("got version %d and nonce %q", mi.Version, mi.Nonce)
+	}
+	if mi.Robot == nil || mi.Robot.X != 2400 || mi.Robot.Y != 2300 || mi.Robot.Angle != 90 {
+		t.Errorf("got robot %+v", mi.Robot)
+	}
+	if mi.Charger == nil || mi.Charger.X != 2080 || mi.Charger.Y != 2080 {
+		t.Errorf("got charger %+v", mi.Charger)
+	}
+	if len(mi.NoGoAreas) != 1 || len(mi.NoGoAreas[0]) != 4 {
+		t.Errorf("got %d no go areas", len(mi.NoGoAreas))
+	}
+	if len(mi.VirtualWalls) != 1 || len(mi.VirtualWalls[0]) != 2 || *mi.VirtualWalls[0][1] != (Point{2250, 2150}) {
+		t.Errorf("got virtual walls %v", mi.VirtualWalls)
+	}
+}
+
+func TestRobotSegment(t *testing.T) {
+	m := readTestMap(t)
+	robot := func() *renderer.Entity {
+		for _, e := range m.Entities {
+			if e.Type == "robot_position" {
+				return e
+			}
+		}
+		t.Fatal("robot_position entity not found")
+		return nil
+	}()
+
+	tests := []struct {
+		name      string
+		x, y      int
+		tolerance int
+		want      string // Empty if robot is not within any segment
+	}{
+		{"within segment", 2400, 2300, 0, "2"},
+		{"between segments without tolerance", 2202, 2100, 0, ""},
+		{"between segments with tolerance", 2202, 2100, 10, "1"},
+		{"too far from segments", 2600, 2600, 50, ""},
+	}
+	for _, tt := range tests {
+		robot.Points = []int{tt.x, tt.y}
+		mi := New(m, time.Time{}, &Settings{RobotSegmentTolerance: tt.tolerance})
+
+		got := ""
+		if mi.RobotSegment != nil {
+			got = mi.RobotSegment.ID
+		}
+		if got != tt.want {
+			t.Errorf("%s: got segment %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	mi := New(readTestMap(t), time.Time{}, &Settings{BrushWidth: 25})
+
+	expected := map[string]float64{"1": 19.8, "2": 15.8, "3": 0}
+	for _, s := range mi.Segments {
+		if s.Coverage != expected[s.ID] {
+			t.Errorf("segment %s: got coverage %v, want %v", s.ID, s.Coverage, expected[s.ID])
+		}
+	}
+	if mi.Coverage != 14.4 {
+		t.Errorf("got total coverage %v, want %v", mi.Coverage, 14.4)
+	}
+}
+
+func TestOdometer(t *testing.T) {
+	mi := New(readTestMap(t), time.Time{}, &Settings{})
+	if mi.PathLength != 5 {
+		t.Fatalf("got path length %v, want %v", mi.PathLength, 5)
+	}
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	o := NewOdometer(100, 2) // Restored after restart, when path was 2m long
+	tests := []struct {
+		pathLength float64
+		want       Travel
+	}{
+		{5, Travel{Total: 103, Speed: 0}},        // No previous update to measure speed
+		{5.5, Travel{Total: 103.5, Speed: 0.05}}, // 0.5m in 10s
+		{5.5, Travel{Total: 103.5, Speed: 0}},
+		{1, Travel{Total: 104.5, Speed: 0.1}}, // Path reset, new path is 1m long
+	}
+	for i, tt := range tests {
+		got := o.Update(&MapInfo{RenderedAt: start.Add(time.Duration(i) * 10 * time.Second), PathLength: tt.pathLength})
+		if *got != tt.want {
+			t.Errorf("update %d: got %+v, want %+v", i, *got, tt.want)
+		}
+	}
+	if total, pathLength := o.State(); total != 104.5 || pathLength != 1 {
+		t.Errorf("got state %v, %v", total, pathLength)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	m := readTestMap(t)
+	d := NewAlertDetector(&AlertSettings{StuckTime: 5 * time.Minute, StuckDistance: 30, DockDistance: 50})
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		minutes      int
+		x, y         int
+		pathLength   float64
+		wantTypes    []string
+		wantSinceMin int // Minute first alert was raised at
+	}{
+		{"within segment", 0, 2400, 2300, 5, []string{}, 0},
+		{"moved slightly", 3, 2410, 2300, 6, []string{}, 0},
+		{"stuck", 5, 2400, 2310, 7, []string{AlertStuck}, 5},
+		{"still stuck", 6, 2400, 2300, 8, []string{AlertStuck}, 5},
+		{"inside no-go area", 7, 2380, 2100, 9, []string{AlertInNoGoArea}, 7},
+		{"outside segments", 8, 2600, 2600, 10, []string{AlertOutsideSegments}, 8},
+		{"docked outside segments", 9, 2080, 2040, 10, []string{}, 0},
+	}
+	for _, tt := range tests {
+		for _, e := range m.Entities {
+			if e.Type == "robot_position" {
+				e.Points = []int{tt.x, tt.y}
+			}
+		}
+		mi := New(m, start.Add(time.Duration(tt.minutes)*time.Minute), &Settings{})
+		mi.PathLength = tt.pathLength
+
+		alerts := d.Update(mi)
+		types := make([]string, 0)
+		for _, a := range alerts {
+			types = append(types, a.Type)
+		}
+		if !reflect.DeepEqual(types, tt.wantTypes) {
+			t.Errorf("%s: got alerts %v, want %v", tt.name, types, tt.wantTypes)
+			continue
+		}
+		if len(alerts) > 0 && !alerts[0].Since.Equal(start.Add(time.Duration(tt.wantSinceMin)*time.Minute)) {
+			t.Errorf("%s: got alert raised at %v", tt.name, alerts[0].Since)
+		}
+	}
+}
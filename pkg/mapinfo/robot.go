@@ -0,0 +1,79 @@
+package mapinfo
+
+import (
+	"math"
+
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+// Returns segment, which robot is currently in. If robot is outside of every
+// segment (e.g. on the edge or on the carpet), the nearest segment within given
+// tolerance (in robot's coordinates system units) is returned. Nil is returned
+// if there is no such segment.
+func findRobotSegment(m *renderer.ValetudoJSON, robot *Position, segments []*Segment, tolerance int) *Segment {
+	if robot == nil {
+		return nil
+	}
+	x, y := robot.X/m.PixelSize, robot.Y/m.PixelSize
+	maxDistance := float64(tolerance) / float64(m.PixelSize)
+
+	var nearestID string
+	nearestDistance := math.Inf(1)
+	for _, l := range m.Layers {
+		if l.Type != "segment" {
+			continue
+		}
+
+		// Quick check using bounding box
+		if float64(l.Dimensions.X.Min-x) > maxDistance || float64(x-l.Dimensions.X.Max) > maxDistance ||
+			float64(l.Dimensions.Y.Min-y) > maxDistance || float64(y-l.Dimensions.Y.Max) > maxDistance {
+			continue
+		}
+
+		d := layerDistance(l, x, y)
+		if d < nearestDistance {
+			nearestID, nearestDistance = l.MetaData.SegmentId, d
+		}
+		if d == 0 {
+			break
+		}
+	}
+
+	if nearestDistance > maxDistance {
+		return nil
+	}
+	for _, s := range segments {
+		if s.ID == nearestID {
+			return s
+		}
+	}
+	return nil
+}
+
+// Returns distance (in pixels) from given pixel to the closest pixel of the layer,
+// which is 0 if pixel is within the layer.
+func layerDistance(l *renderer.Layer, x, y int) float64 {
+	minDistance := math.Inf(1)
+	for i := 0; i+2 < len(l.CompressedPixels); i += 3 {
+		runStart := l.CompressedPixels[i]
+		runEnd := runStart + l.CompressedPixels[i+2] - 1
+		runY := l.CompressedPixels[i+1]
+
+		dx := 0
+		if x < runStart {
+			dx = runStart - x
+		} else if x > runEnd {
+			dx = x - runEnd
+		}
+		dy := y - runY
+
+		d := math.Sqrt(float64(dx*dx + dy*dy))
+		if d < minDistance {
+			minDistance = d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return minDistance
+}
@@ -0,0 +1,68 @@
+package mapinfo
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+type Segment struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Area        float64      `json:"area"` // m²
+	Active      bool         `json:"active"`
+	Coverage    float64      `json:"coverage"` // % of segment, that robot's path has passed over
+	BoundingBox *BoundingBox `json:"bounding_box"`
+}
+
+type BoundingBox struct {
+	MinX int `json:"min_x"`
+	MinY int `json:"min_y"`
+	MaxX int `json:"max_x"`
+	MaxY int `json:"max_y"`
+}
+
+func getSegments(m *renderer.ValetudoJSON) []*Segment {
+	segments := make([]*Segment, 0)
+	for _, l := range m.Layers {
+		if l.Type != "segment" {
+			continue
+		}
+		segments = append(segments, &Segment{
+			ID:     l.MetaData.SegmentId,
+			Name:   l.MetaData.Name,
+			Area:   areaToSquareMeters(l.MetaData.Area),
+			Active: l.MetaData.Active,
+
+			// Layer coordinates are in pixels, while entity ones - in robot's
+			// coordinates system, so convert to the latter
+			BoundingBox: &BoundingBox{
+				MinX: l.Dimensions.X.Min * m.PixelSize,
+				MinY: l.Dimensions.Y.Min * m.PixelSize,
+				MaxX: (l.Dimensions.X.Max + 1) * m.PixelSize,
+				MaxY: (l.Dimensions.Y.Max + 1) * m.PixelSize,
+			},
+		})
+	}
+
+	// Segment IDs are usually numbers
+	sort.Slice(segments, func(i, j int) bool {
+		a, errA := strconv.Atoi(segments[i].ID)
+		b, errB := strconv.Atoi(segments[j].ID)
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return segments[i].ID < segments[j].ID
+	})
+
+	return segments
+}
+
+// Returns segment name, or generic name if segment is not named
+func (s *Segment) DisplayName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return "Segment " + s.ID
+}
@@ -0,0 +1,63 @@
+package mapinfo
+
+import (
+	"math"
+	"time"
+)
+
+// Distance robot has travelled, accumulated over consecutive maps.
+type Travel struct {
+	Total float64 `json:"total"` // m, since the very first map
+	Speed float64 `json:"speed"` // m/s, average since the previous map
+}
+
+// Accumulates distance travelled from path growth. Path is reset by Valetudo
+// when new cleaning starts, so then the whole new path is counted.
+type Odometer struct {
+	total      float64
+	pathLength float64
+	updatedAt  time.Time
+}
+
+// Continues counting from given total distance and the last path length (both in
+// m), e.g. restored after restart.
+func NewOdometer(total, pathLength float64) *Odometer {
+	return &Odometer{total: total, pathLength: pathLength}
+}
+
+// Returns total distance and the last path length (both in m), for restoring
+// odometer later.
+func (o *Odometer) State() (total, pathLength float64) {
+	return o.total, o.pathLength
+}
+
+func (o *Odometer) Update(mi *MapInfo) *Travel {
+	delta := mi.PathLength - o.pathLength
+	if delta < 0 {
+		delta = mi.PathLength
+	}
+
+	speed := 0.0
+	if !o.updatedAt.IsZero() && mi.RenderedAt.After(o.updatedAt) {
+		speed = delta / mi.RenderedAt.Sub(o.updatedAt).Seconds()
+	}
+
+	o.total += delta
+	o.pathLength = mi.PathLength
+	o.updatedAt = mi.RenderedAt
+	return &Travel{
+		Total: math.Round(o.total*100) / 100,
+		Speed: math.Round(speed*100) / 100,
+	}
+}
+
+// Returns length of given lines in m
+func PathLength(path [][]*Point) float64 {
+	length := 0.0
+	for _, points := range path {
+		for i := 1; i < len(points); i++ {
+			length += math.Hypot(float64(points[i].X-points[i-1].X), float64(points[i].Y-points[i-1].Y))
+		}
+	}
+	return math.Round(length) / 100
+}
@@ -0,0 +1,82 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"log"
+
+	mqttgo "github.com/eclipse/paho.mqtt.golang"
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
+)
+
+// Publishes active alerts (as Home Assistant binary sensor) and newly raised alerts
+// as events. Nothing is announced unless alerts are enabled.
+type alertsPublisher struct {
+	client     mqttgo.Client
+	c          *config.MQTTConfig
+	stateTopic string
+	eventTopic string
+	announced  bool
+}
+
+func newAlertsPublisher(client mqttgo.Client, c *config.MQTTConfig) *alertsPublisher {
+	prefix := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier
+	return &alertsPublisher{
+		client:     client,
+		c:          c,
+		stateTopic: prefix + "/MapData/alerts",
+		eventTopic: prefix + "/MapData/alert",
+	}
+}
+
+func (ap *alertsPublisher) publish(mi *mapinfo.MapInfo) {
+	// Alerts are disabled
+	if mi.Alerts == nil {
+		return
+	}
+	if !ap.announced {
+		ap.announce()
+	}
+
+	state := struct {
+		Active bool             `json:"active"`
+		Alerts []*mapinfo.Alert `json:"alerts"`
+	}{len(mi.Alerts) > 0, mi.Alerts}
+	stateData, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("[MQTT producer] Failed to marshal alerts: %v\n", err)
+		return
+	}
+	publish(ap.client, ap.stateTopic, true, stateData)
+
+	// Events are not retained, same as errors
+	for _, a := range mi.Alerts {
+		if !a.Since.Equal(mi.RenderedAt) {
+			continue
+		}
+		eventData, err := json.Marshal(a)
+		if err != nil {
+			log.Printf("[MQTT producer] Failed to marshal alert: %v\n", err)
+			continue
+		}
+		publish(ap.client, ap.eventTopic, false, eventData)
+	}
+}
+
+func (ap *alertsPublisher) announce() {
+	c := ap.c
+	announceTopic := c.Topics.HaAutoconfPrefix + "/binary_sensor/" + c.Topics.ValetudoIdentifier + "/" + c.Topics.ValetudoPrefix + "_" + c.Topics.ValetudoIdentifier + "_alerts/config"
+
+	js := newAnnouncement("Problem", c.Topics.ValetudoIdentifier+"_alerts", c)
+	js.Set("state_topic", ap.stateTopic)
+	js.Set("value_template", "{{ 'ON' if value_json.active else 'OFF' }}")
+	js.Set("json_attributes_topic", ap.stateTopic)
+	js.Set("device_class", "problem")
+
+	announcementData, err := js.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	publish(ap.client, announceTopic, true, announcementData)
+	ap.announced = true
+}
@@ -5,11 +5,11 @@ import (
 	"time"
 
 	mqttgo "github.com/eclipse/paho.mqtt.golang"
+	"github.com/erkexzcx/valetudopng/pkg/archive"
 	"github.com/erkexzcx/valetudopng/pkg/config"
-	"github.com/erkexzcx/valetudopng/pkg/mqtt/decoder"
 )
 
-func startConsumer(c *config.MQTTConfig, mapJSONChan chan []byte) {
+func startConsumer(c *config.MQTTConfig, mapDataChan chan []byte) {
 	opts := mqttgo.NewClientOptions()
 
 	if c.Connection.TLSEnabled {
@@ -28,9 +28,19 @@ func startConsumer(c *config.MQTTConfig, mapJSONChan chan []byte) {
 	opts.SetPassword(c.Connection.Password)
 	opts.SetAutoReconnect(true)
 
+	// Optionally record every received payload for debugging
+	var recorder *archive.Writer
+	if c.Record != nil && c.Record.Enabled {
+		var err error
+		recorder, err = archive.NewWriter(c.Record.Dir, c.Record.MaxFileSizeMB*1000*1000, c.Record.MaxFiles)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	// On received message
 	var handler mqttgo.MessageHandler = func(client mqttgo.Client, msg mqttgo.Message) {
-		consumerMapDataReceiveHandler(client, msg, mapJSONChan)
+		consumerMapDataReceiveHandler(client, msg, mapDataChan, recorder)
 	}
 	opts.SetDefaultPublishHandler(handler)
 
@@ -59,11 +69,13 @@ func startConsumer(c *config.MQTTConfig, mapJSONChan chan []byte) {
 	}
 }
 
-func consumerMapDataReceiveHandler(client mqttgo.Client, msg mqttgo.Message, mapJSONChan chan []byte) {
-	payload, err := decoder.Decode(msg.Payload())
-	if err != nil {
-		log.Println("[MQTT consumer] Failed to process raw data:", err)
-		return
+// Raw payload is decoded by the receiver, so decoding failures are reported
+// together with other rendering failures.
+func consumerMapDataReceiveHandler(client mqttgo.Client, msg mqttgo.Message, mapDataChan chan []byte, recorder *archive.Writer) {
+	if recorder != nil {
+		if err := recorder.Write(time.Now(), msg.Payload()); err != nil {
+			log.Println("[MQTT consumer] Failed to record payload:", err)
+		}
 	}
-	mapJSONChan <- payload
+	mapDataChan <- msg.Payload()
 }
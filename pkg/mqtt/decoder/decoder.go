@@ -5,11 +5,22 @@ import (
 	"compress/zlib"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 )
 
-func Decode(payload []byte) ([]byte, error) {
-	var err error
+func Decode(payload []byte) (decoded []byte, err error) {
+	// Malformed payloads must not bring down the whole service
+	defer func() {
+		if rec := recover(); rec != nil {
+			decoded, err = nil, fmt.Errorf("recovered from panic while decoding payload: %v", rec)
+		}
+	}()
+
+	if len(payload) == 0 {
+		return nil, errors.New("empty payload")
+	}
+
 	if isPNG(payload) {
 		payload, err = extractZtxtValetudoMapPngChunk(payload)
 		if err != nil {
@@ -46,11 +57,21 @@ func extractZtxtValetudoMapPngChunk(data []byte) ([]byte, error) {
 	idx := 8
 
 	for idx < len(data) {
+		// Length of the chunk must fit
+		if idx+4 > len(data) {
+			break
+		}
+
 		// Read the length of the current chunk,
 		// which is stored as a Uint32.
 		length := binary.BigEndian.Uint32(data[idx : idx+4])
 		idx += 4
 
+		// Name/type, contents of the chunk and its CRC must fit
+		if uint64(idx)+4+uint64(length)+4 > uint64(len(data)) {
+			break
+		}
+
 		// Chunk includes name/type for CRC check (see below).
 		chunk := make([]byte, length+4)
 		copy(chunk, data[idx:idx+4])
@@ -81,12 +102,12 @@ func extractZtxtValetudoMapPngChunk(data []byte) ([]byte, error) {
 			i := 0
 			keyword := ""
 
-			for chunkData[i] != 0 && i < 79 {
+			for i < len(chunkData) && chunkData[i] != 0 && i < 79 {
 				keyword += string(chunkData[i])
 				i++
 			}
 
-			if keyword != "ValetudoMap" {
+			if keyword != "ValetudoMap" || i+2 > len(chunkData) {
 				continue
 			}
 
@@ -102,7 +123,7 @@ func extractZtxtValetudoMapPngChunk(data []byte) ([]byte, error) {
 }
 
 func isCompressed(data []byte) bool {
-	return data[0x00] == 0x78
+	return len(data) > 0 && data[0x00] == 0x78
 }
 
 func inflateSync(data []byte) ([]byte, error) {
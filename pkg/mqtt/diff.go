@@ -0,0 +1,76 @@
+package mqtt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+
+	mqttgo "github.com/eclipse/paho.mqtt.golang"
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mapdiff"
+)
+
+// Publishes map diff against reference map (as Home Assistant binary sensor) and
+// diff image. Nothing is announced unless map diff is enabled.
+type diffPublisher struct {
+	client     mqttgo.Client
+	c          *config.MQTTConfig
+	stateTopic string
+	imageTopic string
+	announced  bool
+}
+
+func newDiffPublisher(client mqttgo.Client, c *config.MQTTConfig) *diffPublisher {
+	prefix := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier
+	return &diffPublisher{
+		client:     client,
+		c:          c,
+		stateTopic: prefix + "/MapData/diff",
+		imageTopic: prefix + "/MapData/diff-image",
+	}
+}
+
+// Map diff is only sent when it changes (and never if map diff is disabled).
+func producerMapDiffHandler(client mqttgo.Client, mapDiffChan chan *mapdiff.Diff, c *config.MQTTConfig) {
+	dp := newDiffPublisher(client, c)
+	for diff := range mapDiffChan {
+		dp.publish(diff)
+	}
+}
+
+func (dp *diffPublisher) publish(diff *mapdiff.Diff) {
+	if !dp.announced {
+		dp.announce()
+	}
+
+	stateData, err := json.Marshal(diff)
+	if err != nil {
+		log.Printf("[MQTT producer] Failed to marshal map diff: %v\n", err)
+		return
+	}
+	publish(dp.client, dp.stateTopic, true, stateData)
+
+	img := diff.Image
+	if dp.c.ImageAsBase64 {
+		img = []byte(base64.StdEncoding.EncodeToString(img))
+	}
+	publish(dp.client, dp.imageTopic, true, img)
+}
+
+func (dp *diffPublisher) announce() {
+	c := dp.c
+	announceTopic := c.Topics.HaAutoconfPrefix + "/binary_sensor/" + c.Topics.ValetudoIdentifier + "/" + c.Topics.ValetudoPrefix + "_" + c.Topics.ValetudoIdentifier + "_map_changed/config"
+
+	js := newAnnouncement("Map changed", c.Topics.ValetudoIdentifier+"_map_changed", c)
+	js.Set("state_topic", dp.stateTopic)
+	js.Set("value_template", "{{ 'ON' if value_json.changed else 'OFF' }}")
+	js.Set("json_attributes_topic", dp.stateTopic)
+	js.Set("icon", "mdi:map-search")
+
+	announcementData, err := js.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	publish(dp.client, announceTopic, true, announcementData)
+	dp.announced = true
+}
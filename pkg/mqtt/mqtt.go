@@ -1,10 +1,59 @@
 package mqtt
 
 import (
+	"log"
+
+	"github.com/bitly/go-simplejson"
+	mqttgo "github.com/eclipse/paho.mqtt.golang"
 	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mapdiff"
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
 )
 
-func Start(c *config.MQTTConfig, mapJSONChan, renderedMapChan, calibrationDataChan chan []byte) {
-	go startConsumer(c, mapJSONChan)
-	go startProducer(c, renderedMapChan, calibrationDataChan)
+// Producer sets this topic to "offline" as its Last Will, and to "online" once
+// connected. All announced Home Assistant entities refer to it. Consumer must not
+// share the Last Will, as entities would become unavailable when only consumer
+// disconnects, while producer keeps publishing.
+func statusTopic(c *config.MQTTConfig) string {
+	return c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/valetudopng/status"
+}
+
+const (
+	statusOnline  = "online"
+	statusOffline = "offline"
+)
+
+func publishStatusOnline(client mqttgo.Client, c *config.MQTTConfig) {
+	token := client.Publish(statusTopic(c), 1, true, statusOnline)
+	token.Wait()
+	if token.Error() != nil {
+		log.Printf("[MQTT] Failed to publish status: %v\n", token.Error())
+	}
+}
+
+// Returns Home Assistant discovery config with fields, common for all entities.
+func newAnnouncement(name, uniqueID string, c *config.MQTTConfig) *simplejson.Json {
+	js := simplejson.New()
+	js.Set("name", name)
+	js.Set("unique_id", uniqueID)
+	js.Set("availability_topic", statusTopic(c))
+	js.Set("payload_available", statusOnline)
+	js.Set("payload_not_available", statusOffline)
+
+	device := simplejson.New()
+	device.Set("name", c.Topics.ValetudoIdentifier)
+	device.Set("identifiers", []string{c.Topics.ValetudoIdentifier})
+
+	js.Set("device", device)
+	return js
+}
+
+func Start(c *config.MQTTConfig, mapDataChan, renderedMapChan, calibrationDataChan, renderedSVGChan, renderErrorChan chan []byte, mapInfoChan chan *mapinfo.MapInfo, mapDiffChan chan *mapdiff.Diff) {
+	go startConsumer(c, mapDataChan)
+	go startProducer(c, renderedMapChan, calibrationDataChan, renderedSVGChan, renderErrorChan, mapInfoChan, mapDiffChan)
+}
+
+// Starts producer only, for when map data comes from elsewhere (e.g. replayed archive).
+func StartProducer(c *config.MQTTConfig, renderedMapChan, calibrationDataChan, renderedSVGChan, renderErrorChan chan []byte, mapInfoChan chan *mapinfo.MapInfo, mapDiffChan chan *mapdiff.Diff) {
+	go startProducer(c, renderedMapChan, calibrationDataChan, renderedSVGChan, renderErrorChan, mapInfoChan, mapDiffChan)
 }
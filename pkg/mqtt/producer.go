@@ -1,12 +1,16 @@
 package mqtt
 
 import (
+	"encoding/json"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/bitly/go-simplejson"
 	mqttgo "github.com/eclipse/paho.mqtt.golang"
 	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mapdiff"
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
 )
 
 type Device struct {
@@ -21,7 +25,7 @@ type Map struct {
 	Topic    string `json:"topic"`
 }
 
-func startProducer(c *config.MQTTConfig, renderedMapChan, calibrationDataChan chan []byte) {
+func startProducer(c *config.MQTTConfig, renderedMapChan, calibrationDataChan, renderedSVGChan, renderErrorChan chan []byte, mapInfoChan chan *mapinfo.MapInfo, mapDiffChan chan *mapdiff.Diff) {
 	opts := mqttgo.NewClientOptions()
 
 	if c.Connection.TLSEnabled {
@@ -39,10 +43,12 @@ func startProducer(c *config.MQTTConfig, renderedMapChan, calibrationDataChan ch
 	opts.SetUsername(c.Connection.Username)
 	opts.SetPassword(c.Connection.Password)
 	opts.SetAutoReconnect(true)
+	opts.SetWill(statusTopic(c), statusOffline, 1, true)
 
 	// On connection
 	opts.OnConnect = func(client mqttgo.Client) {
 		log.Println("[MQTT producer] Connected")
+		publishStatusOnline(client, c)
 	}
 
 	// On disconnection
@@ -62,12 +68,79 @@ func startProducer(c *config.MQTTConfig, renderedMapChan, calibrationDataChan ch
 	}
 
 	renderedMapTopic := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/MapData/map"
-	go produceAnnounceMapTopic(client, renderedMapTopic, c)
-	go producerMapUpdatesHandler(client, renderedMapChan, renderedMapTopic)
+	mapURLTopic := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/MapData/map-url"
+	go produceAnnounceMapTopic(client, renderedMapTopic, mapURLTopic, c)
+	if c.HaMapEntity == "image_url" {
+		go producerMapURLUpdatesHandler(client, renderedMapChan, renderedMapTopic, mapURLTopic, c.ImageURL)
+	} else {
+		go producerMapUpdatesHandler(client, renderedMapChan, renderedMapTopic)
+	}
 
 	calibrationTopic := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/MapData/calibration"
 	go producerAnnounceCalibrationTopic(client, calibrationTopic, c)
 	go producerCalibrationDataHandler(client, calibrationDataChan, calibrationTopic)
+
+	if c.PublishSVG {
+		renderedSVGTopic := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/MapData/map-svg"
+		go producerMapUpdatesHandler(client, renderedSVGChan, renderedSVGTopic)
+	}
+
+	renderErrorTopic := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/MapData/error"
+	go producerRenderErrorHandler(client, renderErrorChan, renderErrorTopic)
+
+	totalAreaTopic := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/MapData/total-area"
+	go producerAnnounceTotalAreaTopic(client, totalAreaTopic, c)
+	coverageTopic := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/MapData/coverage"
+	go producerAnnounceCoverageTopic(client, coverageTopic, c)
+	travelTopic := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/MapData/travel"
+	go producerAnnounceTravelTopic(client, travelTopic, c)
+	robotSegmentTopic := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/MapData/robot-segment"
+	go producerAnnounceRobotSegmentTopic(client, robotSegmentTopic, c)
+	summaryTopic := c.Topics.ValetudoPrefix + "/" + c.Topics.ValetudoIdentifier + "/MapData/summary"
+	go producerMapInfoHandler(client, mapInfoChan, totalAreaTopic, coverageTopic, travelTopic, robotSegmentTopic, summaryTopic, c)
+	go producerMapDiffHandler(client, mapDiffChan, c)
+}
+
+// Publishes details about the map, extracted from every rendered map
+func producerMapInfoHandler(client mqttgo.Client, mapInfoChan chan *mapinfo.MapInfo, tat, ct, tt, rst, st string, c *config.MQTTConfig) {
+	segments := newSegmentsPublisher(client, c)
+	go segments.loadAnnounced()
+	alerts := newAlertsPublisher(client, c)
+	for mi := range mapInfoChan {
+		summaryData, err := json.Marshal(mi)
+		if err != nil {
+			log.Printf("[MQTT producer] Failed to marshal map summary: %v\n", err)
+		} else {
+			publish(client, st, true, summaryData)
+		}
+
+		publish(client, tat, true, []byte(strconv.FormatFloat(mi.TotalArea, 'f', 2, 64)))
+		publish(client, ct, true, []byte(strconv.FormatFloat(mi.Coverage, 'f', 1, 64)))
+		segments.publish(mi)
+		alerts.publish(mi)
+
+		travelData, err := travelState(mi)
+		if err != nil {
+			log.Printf("[MQTT producer] Failed to marshal travel: %v\n", err)
+		} else {
+			publish(client, tt, true, travelData)
+		}
+
+		robotSegmentData, err := robotSegmentState(mi)
+		if err != nil {
+			log.Printf("[MQTT producer] Failed to marshal robot segment: %v\n", err)
+		} else {
+			publish(client, rst, true, robotSegmentData)
+		}
+	}
+}
+
+func publish(client mqttgo.Client, topic string, retained bool, payload []byte) {
+	token := client.Publish(topic, 1, retained, payload)
+	token.Wait()
+	if token.Error() != nil {
+		log.Printf("[MQTT producer] Failed to publish: %v\n", token.Error())
+	}
 }
 
 func producerMapUpdatesHandler(client mqttgo.Client, renderedMapChan chan []byte, topic string) {
@@ -80,26 +153,78 @@ func producerMapUpdatesHandler(client mqttgo.Client, renderedMapChan chan []byte
 	}
 }
 
-func produceAnnounceMapTopic(client mqttgo.Client, rmt string, c *config.MQTTConfig) {
-	announceTopic := c.Topics.HaAutoconfPrefix + "/camera/" + c.Topics.ValetudoIdentifier + "/" + c.Topics.ValetudoPrefix + "_" + c.Topics.ValetudoIdentifier + "_map/config"
+// Errors are events, so unlike map updates they are not retained
+func producerRenderErrorHandler(client mqttgo.Client, renderErrorChan chan []byte, topic string) {
+	for event := range renderErrorChan {
+		token := client.Publish(topic, 1, false, event)
+		token.Wait()
+		if token.Error() != nil {
+			log.Printf("[MQTT producer] Failed to publish: %v\n", token.Error())
+		}
+	}
+}
 
-	js := simplejson.New()
-	js.Set("name", "Map")
-	js.Set("unique_id", c.Topics.ValetudoIdentifier+"_rendered_map")
-	js.Set("topic", rmt)
+// Also publishes a new URL on every update, so Home Assistant image entity (in URL
+// mode) knows it has to fetch the image again.
+func producerMapURLUpdatesHandler(client mqttgo.Client, renderedMapChan chan []byte, topic, urlTopic, imageURL string) {
+	separator := "?"
+	if strings.Contains(imageURL, "?") {
+		separator = "&"
+	}
 
-	device := simplejson.New()
-	device.Set("name", c.Topics.ValetudoIdentifier)
-	device.Set("identifiers", []string{c.Topics.ValetudoIdentifier})
+	for img := range renderedMapChan {
+		token := client.Publish(topic, 1, true, img)
+		token.Wait()
+		if token.Error() != nil {
+			log.Printf("[MQTT producer] Failed to publish: %v\n", token.Error())
+		}
 
-	js.Set("device", device)
+		url := imageURL + separator + "t=" + strconv.FormatInt(time.Now().UnixMilli(), 10)
+		token = client.Publish(urlTopic, 1, true, url)
+		token.Wait()
+		if token.Error() != nil {
+			log.Printf("[MQTT producer] Failed to publish: %v\n", token.Error())
+		}
+	}
+}
+
+func produceAnnounceMapTopic(client mqttgo.Client, rmt, mut string, c *config.MQTTConfig) {
+	cameraAnnounceTopic := c.Topics.HaAutoconfPrefix + "/camera/" + c.Topics.ValetudoIdentifier + "/" + c.Topics.ValetudoPrefix + "_" + c.Topics.ValetudoIdentifier + "_map/config"
+	imageAnnounceTopic := c.Topics.HaAutoconfPrefix + "/image/" + c.Topics.ValetudoIdentifier + "/" + c.Topics.ValetudoPrefix + "_" + c.Topics.ValetudoIdentifier + "_map/config"
+
+	js := newAnnouncement("Map", c.Topics.ValetudoIdentifier+"_rendered_map", c)
+
+	var announceTopic, staleAnnounceTopic string
+	switch c.HaMapEntity {
+	case "image":
+		announceTopic, staleAnnounceTopic = imageAnnounceTopic, cameraAnnounceTopic
+		js.Set("image_topic", rmt)
+		js.Set("content_type", "image/png")
+	case "image_url":
+		announceTopic, staleAnnounceTopic = imageAnnounceTopic, cameraAnnounceTopic
+		js.Set("url_topic", mut)
+	default:
+		announceTopic, staleAnnounceTopic = cameraAnnounceTopic, imageAnnounceTopic
+		js.Set("topic", rmt)
+	}
+	if c.ImageAsBase64 && c.HaMapEntity != "image_url" {
+		js.Set("image_encoding", "b64")
+	}
 
 	announcementData, err := js.MarshalJSON()
 	if err != nil {
 		panic(err)
 	}
 
-	token := client.Publish(announceTopic, 1, true, announcementData)
+	// Empty retained message removes entity, which was announced before switching
+	// to another entity type
+	token := client.Publish(staleAnnounceTopic, 1, true, []byte{})
+	token.Wait()
+	if token.Error() != nil {
+		log.Printf("[MQTT producer] Failed to publish: %v\n", token.Error())
+	}
+
+	token = client.Publish(announceTopic, 1, true, announcementData)
 	token.Wait()
 	if token.Error() != nil {
 		log.Printf("[MQTT producer] Failed to publish: %v\n", token.Error())
@@ -119,17 +244,9 @@ func producerCalibrationDataHandler(client mqttgo.Client, calibrationDataChan ch
 func producerAnnounceCalibrationTopic(client mqttgo.Client, cdt string, c *config.MQTTConfig) {
 	announceTopic := c.Topics.HaAutoconfPrefix + "/sensor/" + c.Topics.ValetudoIdentifier + "/" + c.Topics.ValetudoPrefix + "_" + c.Topics.ValetudoIdentifier + "_calibration/config"
 
-	js := simplejson.New()
-	js.Set("name", "Calibration")
-	js.Set("unique_id", c.Topics.ValetudoIdentifier+"_calibration")
+	js := newAnnouncement("Calibration", c.Topics.ValetudoIdentifier+"_calibration", c)
 	js.Set("state_topic", cdt)
 
-	device := simplejson.New()
-	device.Set("name", c.Topics.ValetudoIdentifier)
-	device.Set("identifiers", []string{c.Topics.ValetudoIdentifier})
-
-	js.Set("device", device)
-
 	announcementData, err := js.MarshalJSON()
 	if err != nil {
 		panic(err)
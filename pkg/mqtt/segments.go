@@ -0,0 +1,237 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	mqttgo "github.com/eclipse/paho.mqtt.golang"
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
+)
+
+// How long to wait for retained segment announcements on startup
+const retainedAnnouncementsWait = 2 * time.Second
+
+// Announces (and publishes state of) area and coverage sensors for every segment. Sensors of
+// segments, which no longer exist, are removed.
+type segmentsPublisher struct {
+	client mqttgo.Client
+	c      *config.MQTTConfig
+
+	// Retained announcements are loaded concurrently with publishing
+	mux       sync.Mutex
+	announced map[string]string   // Segment ID to announced name
+	current   map[string]struct{} // Segment IDs of the last published map, nil until then
+}
+
+func newSegmentsPublisher(client mqttgo.Client, c *config.MQTTConfig) *segmentsPublisher {
+	return &segmentsPublisher{
+		client:    client,
+		c:         c,
+		announced: make(map[string]string),
+	}
+}
+
+// Segments could have been removed while service was down, so segments announced
+// before (retained by the broker) are loaded. Those missing in the map get their
+// sensors removed. Waiting for retained messages takes a while, so it's meant to
+// be run in its own goroutine, without holding back published maps.
+func (sp *segmentsPublisher) loadAnnounced() {
+	var mux sync.Mutex
+	found := make(map[string]struct{})
+	topic := sp.c.Topics.HaAutoconfPrefix + "/sensor/" + sp.c.Topics.ValetudoIdentifier + "/+/config"
+	token := sp.client.Subscribe(topic, 1, func(_ mqttgo.Client, msg mqttgo.Message) {
+		if len(msg.Payload()) == 0 {
+			return
+		}
+		if id, ok := sp.segmentIDFromAnnounceTopic(msg.Topic()); ok {
+			mux.Lock()
+			found[id] = struct{}{}
+			mux.Unlock()
+		}
+	})
+	if token.Wait() && token.Error() != nil {
+		log.Printf("[MQTT producer] Failed to subscribe to segment announcements: %v\n", token.Error())
+		return
+	}
+	time.Sleep(retainedAnnouncementsWait)
+	if token := sp.client.Unsubscribe(topic); token.Wait() && token.Error() != nil {
+		log.Printf("[MQTT producer] Failed to unsubscribe from segment announcements: %v\n", token.Error())
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	sp.addAnnounced(found)
+}
+
+// Adds segments announced before. If map was already published in the meantime,
+// those missing in it are removed right away, otherwise with the first map.
+func (sp *segmentsPublisher) addAnnounced(found map[string]struct{}) {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
+
+	for id := range found {
+		// Empty name makes sure segment gets announced again if it still exists
+		if _, ok := sp.announced[id]; !ok {
+			sp.announced[id] = ""
+		}
+	}
+	if sp.current != nil {
+		sp.removeMissing()
+	}
+}
+
+// Returns segment ID from topic returned by segmentAnnounceTopic.
+func (sp *segmentsPublisher) segmentIDFromAnnounceTopic(topic string) (string, bool) {
+	prefix := sp.c.Topics.HaAutoconfPrefix + "/sensor/" + sp.c.Topics.ValetudoIdentifier + "/" + sp.c.Topics.ValetudoPrefix + "_" + sp.c.Topics.ValetudoIdentifier + "_segment_"
+	if !strings.HasPrefix(topic, prefix) || !strings.HasSuffix(topic, "/config") {
+		return "", false
+	}
+	objectID := strings.TrimSuffix(strings.TrimPrefix(topic, prefix), "/config")
+	for _, sensor := range []string{"_area", "_coverage"} {
+		if id := strings.TrimSuffix(objectID, sensor); id != objectID && id != "" {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func (sp *segmentsPublisher) segmentTopic(id string) string {
+	return sp.c.Topics.ValetudoPrefix + "/" + sp.c.Topics.ValetudoIdentifier + "/MapData/segments/" + id
+}
+
+// Sensor is either "area" or "coverage"
+func (sp *segmentsPublisher) segmentAnnounceTopic(id, sensor string) string {
+	return sp.c.Topics.HaAutoconfPrefix + "/sensor/" + sp.c.Topics.ValetudoIdentifier + "/" + sp.c.Topics.ValetudoPrefix + "_" + sp.c.Topics.ValetudoIdentifier + "_segment_" + id + "_" + sensor + "/config"
+}
+
+func (sp *segmentsPublisher) publish(mi *mapinfo.MapInfo) {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
+
+	current := make(map[string]struct{}, len(mi.Segments))
+	for _, s := range mi.Segments {
+		current[s.ID] = struct{}{}
+
+		if name, found := sp.announced[s.ID]; !found || name != s.DisplayName() {
+			sp.announce(s)
+		}
+
+		stateData, err := json.Marshal(s)
+		if err != nil {
+			log.Printf("[MQTT producer] Failed to marshal segment: %v\n", err)
+			continue
+		}
+		publish(sp.client, sp.segmentTopic(s.ID), true, stateData)
+	}
+
+	sp.current = current
+	sp.removeMissing()
+}
+
+// Removes segments, which no longer exist. Must be called with mux held.
+func (sp *segmentsPublisher) removeMissing() {
+	for id := range sp.announced {
+		if _, found := sp.current[id]; found {
+			continue
+		}
+		publish(sp.client, sp.segmentAnnounceTopic(id, "area"), true, []byte{})
+		publish(sp.client, sp.segmentAnnounceTopic(id, "coverage"), true, []byte{})
+		publish(sp.client, sp.segmentTopic(id), true, []byte{})
+		delete(sp.announced, id)
+	}
+}
+
+func (sp *segmentsPublisher) announce(s *mapinfo.Segment) {
+	js := newAnnouncement(s.DisplayName()+" area", sp.c.Topics.ValetudoIdentifier+"_segment_"+s.ID+"_area", sp.c)
+	js.Set("state_topic", sp.segmentTopic(s.ID))
+	js.Set("value_template", "{{ value_json.area }}")
+	js.Set("json_attributes_topic", sp.segmentTopic(s.ID))
+	js.Set("unit_of_measurement", "m²")
+	js.Set("state_class", "measurement")
+	js.Set("icon", "mdi:floor-plan")
+
+	announcementData, err := js.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	publish(sp.client, sp.segmentAnnounceTopic(s.ID, "area"), true, announcementData)
+
+	js = newAnnouncement(s.DisplayName()+" coverage", sp.c.Topics.ValetudoIdentifier+"_segment_"+s.ID+"_coverage", sp.c)
+	js.Set("state_topic", sp.segmentTopic(s.ID))
+	js.Set("value_template", "{{ value_json.coverage }}")
+	js.Set("unit_of_measurement", "%")
+	js.Set("state_class", "measurement")
+	js.Set("icon", "mdi:robot-vacuum")
+
+	announcementData, err = js.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	publish(sp.client, sp.segmentAnnounceTopic(s.ID, "coverage"), true, announcementData)
+	sp.announced[s.ID] = s.DisplayName()
+}
+
+func producerAnnounceTotalAreaTopic(client mqttgo.Client, tat string, c *config.MQTTConfig) {
+	announceTopic := c.Topics.HaAutoconfPrefix + "/sensor/" + c.Topics.ValetudoIdentifier + "/" + c.Topics.ValetudoPrefix + "_" + c.Topics.ValetudoIdentifier + "_total_area/config"
+
+	js := newAnnouncement("Total area", c.Topics.ValetudoIdentifier+"_total_area", c)
+	js.Set("state_topic", tat)
+	js.Set("unit_of_measurement", "m²")
+	js.Set("state_class", "measurement")
+	js.Set("icon", "mdi:floor-plan")
+
+	announcementData, err := js.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	publish(client, announceTopic, true, announcementData)
+}
+
+func producerAnnounceRobotSegmentTopic(client mqttgo.Client, rst string, c *config.MQTTConfig) {
+	announceTopic := c.Topics.HaAutoconfPrefix + "/sensor/" + c.Topics.ValetudoIdentifier + "/" + c.Topics.ValetudoPrefix + "_" + c.Topics.ValetudoIdentifier + "_robot_segment/config"
+
+	js := newAnnouncement("Current room", c.Topics.ValetudoIdentifier+"_robot_segment", c)
+	js.Set("state_topic", rst)
+	js.Set("value_template", "{{ value_json.name if value_json.name else 'none' }}")
+	js.Set("json_attributes_topic", rst)
+	js.Set("icon", "mdi:home-map-marker")
+
+	announcementData, err := js.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	publish(client, announceTopic, true, announcementData)
+}
+
+// Both fields are nil if robot is not within any segment
+func robotSegmentState(mi *mapinfo.MapInfo) ([]byte, error) {
+	state := struct {
+		ID   *string `json:"id"`
+		Name *string `json:"name"`
+	}{}
+	if mi.RobotSegment != nil {
+		name := mi.RobotSegment.DisplayName()
+		state.ID, state.Name = &mi.RobotSegment.ID, &name
+	}
+	return json.Marshal(state)
+}
+
+func producerAnnounceCoverageTopic(client mqttgo.Client, ct string, c *config.MQTTConfig) {
+	announceTopic := c.Topics.HaAutoconfPrefix + "/sensor/" + c.Topics.ValetudoIdentifier + "/" + c.Topics.ValetudoPrefix + "_" + c.Topics.ValetudoIdentifier + "_coverage/config"
+
+	js := newAnnouncement("Coverage", c.Topics.ValetudoIdentifier+"_coverage", c)
+	js.Set("state_topic", ct)
+	js.Set("unit_of_measurement", "%")
+	js.Set("state_class", "measurement")
+	js.Set("icon", "mdi:robot-vacuum")
+
+	announcementData, err := js.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	publish(client, announceTopic, true, announcementData)
+}
@@ -0,0 +1,96 @@
+package mqtt
+
+import (
+	"sync"
+	"testing"
+
+	mqttgo "github.com/eclipse/paho.mqtt.golang"
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
+)
+
+type fakeToken struct{ mqttgo.Token }
+
+func (fakeToken) Wait() bool   { return true }
+func (fakeToken) Error() error { return nil }
+
+// Records retained messages, as broker would keep them.
+type fakeClient struct {
+	mqttgo.Client
+	mux      sync.Mutex
+	retained map[string][]byte
+}
+
+func (fc *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqttgo.Token {
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+	if data := payload.([]byte); len(data) == 0 {
+		delete(fc.retained, topic)
+	} else {
+		fc.retained[topic] = data
+	}
+	return fakeToken{}
+}
+
+func testMQTTConfig() *config.MQTTConfig {
+	return &config.MQTTConfig{Topics: &config.TopicsConfig{
+		ValetudoPrefix:     "valetudo",
+		ValetudoIdentifier: "robot",
+		HaAutoconfPrefix:   "homeassistant",
+	}}
+}
+
+func TestSegmentIDFromAnnounceTopic(t *testing.T) {
+	sp := newSegmentsPublisher(nil, testMQTTConfig())
+
+	for _, id := range []string{"1", "17", "a_b"} {
+		for _, sensor := range []string{"area", "coverage"} {
+			got, ok := sp.segmentIDFromAnnounceTopic(sp.segmentAnnounceTopic(id, sensor))
+			if !ok || got != id {
+				t.Errorf("got %q, %v for segment %s %s sensor", got, ok, id, sensor)
+			}
+		}
+	}
+
+	for _, topic := range []string{
+		"homeassistant/sensor/robot/valetudo_robot_total_area/config",
+		"homeassistant/sensor/robot/valetudo_robot_coverage/config",
+		"homeassistant/sensor/robot/valetudo_robot_segment__area/config",
+		"homeassistant/sensor/other/valetudo_other_segment_1_area/config",
+		"homeassistant/sensor/robot/valetudo_robot_segment_1_speed/config",
+	} {
+		if id, ok := sp.segmentIDFromAnnounceTopic(topic); ok {
+			t.Errorf("got segment %q from %s", id, topic)
+		}
+	}
+}
+
+func TestSegmentsAddAnnounced(t *testing.T) {
+	mi := &mapinfo.MapInfo{Segments: []*mapinfo.Segment{{ID: "1", Name: "Kitchen"}}}
+	found := map[string]struct{}{"1": {}, "2": {}}
+
+	// Retained announcements are loaded either before or after the first map
+	for _, loadedFirst := range []bool{true, false} {
+		fc := &fakeClient{retained: make(map[string][]byte)}
+		sp := newSegmentsPublisher(fc, testMQTTConfig())
+		fc.retained[sp.segmentAnnounceTopic("2", "area")] = []byte("{}")
+		fc.retained[sp.segmentAnnounceTopic("2", "coverage")] = []byte("{}")
+
+		if loadedFirst {
+			sp.addAnnounced(found)
+			sp.publish(mi)
+		} else {
+			sp.publish(mi)
+			sp.addAnnounced(found)
+		}
+
+		for _, sensor := range []string{"area", "coverage"} {
+			if _, ok := fc.retained[sp.segmentAnnounceTopic("2", sensor)]; ok {
+				t.Errorf("removed segment %s sensor kept (loaded first: %v)", sensor, loadedFirst)
+			}
+			if _, ok := fc.retained[sp.segmentAnnounceTopic("1", sensor)]; !ok {
+				t.Errorf("existing segment %s sensor removed (loaded first: %v)", sensor, loadedFirst)
+			}
+		}
+	}
+}
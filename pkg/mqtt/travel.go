@@ -0,0 +1,56 @@
+package mqtt
+
+import (
+	"encoding/json"
+
+	mqttgo "github.com/eclipse/paho.mqtt.golang"
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
+)
+
+type travelSensor struct {
+	id, name      string
+	valueTemplate string
+	unit          string
+	deviceClass   string
+	stateClass    string
+	icon          string
+}
+
+// Total distance is meant for Home Assistant utility meters (e.g. to track brush wear)
+var travelSensors = []travelSensor{
+	{"distance_total", "Total distance", "{{ value_json.total }}", "m", "distance", "total_increasing", "mdi:map-marker-distance"},
+	{"path_length", "Path length", "{{ value_json.path_length }}", "m", "distance", "measurement", "mdi:map-marker-path"},
+	{"speed", "Speed", "{{ value_json.speed }}", "m/s", "speed", "measurement", "mdi:speedometer"},
+}
+
+func producerAnnounceTravelTopic(client mqttgo.Client, tt string, c *config.MQTTConfig) {
+	for _, s := range travelSensors {
+		announceTopic := c.Topics.HaAutoconfPrefix + "/sensor/" + c.Topics.ValetudoIdentifier + "/" + c.Topics.ValetudoPrefix + "_" + c.Topics.ValetudoIdentifier + "_" + s.id + "/config"
+
+		js := newAnnouncement(s.name, c.Topics.ValetudoIdentifier+"_"+s.id, c)
+		js.Set("state_topic", tt)
+		js.Set("value_template", s.valueTemplate)
+		js.Set("unit_of_measurement", s.unit)
+		js.Set("device_class", s.deviceClass)
+		js.Set("state_class", s.stateClass)
+		js.Set("icon", s.icon)
+
+		announcementData, err := js.MarshalJSON()
+		if err != nil {
+			panic(err)
+		}
+		publish(client, announceTopic, true, announcementData)
+	}
+}
+
+func travelState(mi *mapinfo.MapInfo) ([]byte, error) {
+	state := struct {
+		*mapinfo.Travel
+		PathLength float64 `json:"path_length"`
+	}{mi.Travel, mi.PathLength}
+	if state.Travel == nil {
+		state.Travel = &mapinfo.Travel{}
+	}
+	return json.Marshal(state)
+}
@@ -1,6 +1,7 @@
 package renderer
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"math"
@@ -41,6 +42,9 @@ type valetudoImage struct {
 	// Segment ID to segment (room) color
 	segmentColor map[string]color.RGBA
 
+	// Path passes over every pixel, nil if heatmap is disabled
+	passes *PassCounts
+
 	// Rotation functions
 	RotateLayer  rotationFunc
 	RotateEntity rotationFunc
@@ -77,6 +81,10 @@ func newValetudoImage(valetudoJSON *ValetudoJSON, r *Renderer) *valetudoImage {
 	vi.segmentColor = make(map[string]color.RGBA)
 	vi.findFourColors(r.settings.SegmentColors)
 
+	if r.settings.HeatmapEnabled {
+		vi.passes = CountPasses(valetudoJSON, r.settings.HeatmapBrushWidth)
+	}
+
 	// Find map bounds within robot's coordinates system (from given layers)
 	vi.robotCoords.minX = math.MaxInt32
 	vi.robotCoords.minY = math.MaxInt32
@@ -135,9 +143,30 @@ func newValetudoImage(valetudoJSON *ValetudoJSON, r *Renderer) *valetudoImage {
 	return vi
 }
 
-func (vi *valetudoImage) DrawAll() {
-	vi.drawLayers()
-	vi.upscaleToGGContext()
+// Keeps the first panic of worker goroutines, which run outside of Render's
+// recover, so it can be returned as an error instead of crashing the process.
+type workerPanic struct {
+	mux sync.Mutex
+	err error
+}
+
+func (p *workerPanic) recover() {
+	if rec := recover(); rec != nil {
+		p.mux.Lock()
+		if p.err == nil {
+			p.err = fmt.Errorf("recovered from panic while drawing map: %v", rec)
+		}
+		p.mux.Unlock()
+	}
+}
+
+func (vi *valetudoImage) DrawAll() error {
+	if err := vi.drawLayers(); err != nil {
+		return err
+	}
+	if err := vi.upscaleToGGContext(); err != nil {
+		return err
+	}
 
 	// Draw path entity
 	col := vi.renderer.settings.PathColor
@@ -157,23 +186,25 @@ func (vi *valetudoImage) DrawAll() {
 		vi.drawEntityVirtualWall(e)
 	}
 	vi.ggContext.Stroke()
-	// Draw no_go_area entities
-	lineWidth := float64(vi.renderer.settings.Scale * 0.5)
-	noGoAreas := vi.entities["no_go_area"]
-	col = vi.renderer.settings.NoGoAreaColor
+
+	// Draw area entities
+	s := vi.renderer.settings
+	vi.drawAreas("no_mop_area", s.NoMopAreaColor, s.NoMopAreaOutlineColor, true)
+	vi.drawAreas("no_go_area", s.NoGoAreaColor, s.VirtualWallColor, false)
+	vi.drawAreas("active_zone", s.ActiveZoneColor, s.ActiveZoneOutlineColor, false)
+
+	// Draw go_to_target entity
+	col = s.GoToTargetColor
 	vi.ggContext.SetRGBA255(int(col.R), int(col.G), int(col.B), int(col.A))
-	vi.ggContext.SetLineWidth(0)
-	for _, e := range noGoAreas {
-		vi.drawEntityNoGoArea(e)
+	vi.ggContext.SetLineWidth(s.Scale * 0.5)
+	for _, e := range vi.entities["go_to_target"] {
+		vi.drawEntityGoToTarget(e)
 	}
-	vi.ggContext.Fill()
-	col = vi.renderer.settings.VirtualWallColor
-	vi.ggContext.SetRGBA255(int(col.R), int(col.G), int(col.B), int(col.A))
-	vi.ggContext.SetLineWidth(lineWidth)
-	for _, e := range noGoAreas {
-		vi.drawEntityNoGoArea(e)
+
+	// Draw obstacle entities
+	if !vi.renderer.settings.ObstaclesHidden {
+		vi.drawObstacles()
 	}
-	vi.ggContext.Stroke()
 
 	// Draw charger_location entity
 	for _, e := range vi.entities["charger_location"] {
@@ -184,9 +215,42 @@ func (vi *valetudoImage) DrawAll() {
 	for _, e := range vi.entities["robot_position"] {
 		vi.drawEntityRobot(e, int(vi.renderer.settings.Scale)/2, -1)
 	}
+
+	// Draw segment names
+	if vi.renderer.settings.LabelsEnabled {
+		vi.drawLabels()
+	}
+
+	return nil
 }
 
-func (vi *valetudoImage) upscaleToGGContext() {
+// Draws filled area entities of given type with outline, which is dashed if needed.
+func (vi *valetudoImage) drawAreas(entityType string, fill, outline color.RGBA, dashed bool) {
+	entities := vi.entities[entityType]
+	if len(entities) == 0 {
+		return
+	}
+
+	vi.ggContext.SetRGBA255(int(fill.R), int(fill.G), int(fill.B), int(fill.A))
+	for _, e := range entities {
+		vi.drawEntityArea(e)
+	}
+	vi.ggContext.Fill()
+
+	lineWidth := vi.renderer.settings.Scale * 0.5
+	vi.ggContext.SetRGBA255(int(outline.R), int(outline.G), int(outline.B), int(outline.A))
+	vi.ggContext.SetLineWidth(lineWidth)
+	if dashed {
+		vi.ggContext.SetDash(lineWidth*4, lineWidth*2)
+	}
+	for _, e := range entities {
+		vi.drawEntityArea(e)
+	}
+	vi.ggContext.Stroke()
+	vi.ggContext.SetDash()
+}
+
+func (vi *valetudoImage) upscaleToGGContext() error {
 	scale := int(vi.renderer.settings.Scale)
 	scaledImgWidth := vi.unscaledImgWidth * scale
 	scaledImgHeight := vi.unscaledImgHeight * scale
@@ -194,24 +258,28 @@ func (vi *valetudoImage) upscaleToGGContext() {
 
 	numCPUs := runtime.NumCPU()
 	var wg sync.WaitGroup
+	var p workerPanic
 	jobs := make(chan int, vi.unscaledImgHeight)
 
 	// Start workers
 	for w := 0; w < numCPUs; w++ {
 		go func() {
 			for y := range jobs {
-				yScale := y * scale
-				yUnscaledImgWidth := y * vi.unscaledImgWidth
-				for x := 0; x < vi.unscaledImgWidth; x++ {
-					xScale := x * scale
-					for scaleIndex := 0; scaleIndex < scale; scaleIndex++ {
-						copy(scaledImg.Pix[(yScale*scaledImgWidth+xScale+scaleIndex)*4:(yScale*scaledImgWidth+xScale+scaleIndex+1)*4], vi.img.Pix[(yUnscaledImgWidth+x)*4:(yUnscaledImgWidth+x+1)*4])
+				func() {
+					defer wg.Done()
+					defer p.recover()
+					yScale := y * scale
+					yUnscaledImgWidth := y * vi.unscaledImgWidth
+					for x := 0; x < vi.unscaledImgWidth; x++ {
+						xScale := x * scale
+						for scaleIndex := 0; scaleIndex < scale; scaleIndex++ {
+							copy(scaledImg.Pix[(yScale*scaledImgWidth+xScale+scaleIndex)*4:(yScale*scaledImgWidth+xScale+scaleIndex+1)*4], vi.img.Pix[(yUnscaledImgWidth+x)*4:(yUnscaledImgWidth+x+1)*4])
+						}
 					}
-				}
-				for scaleIndex := 1; scaleIndex < scale; scaleIndex++ {
-					copy(scaledImg.Pix[((yScale+scaleIndex)*scaledImgWidth)*4:((yScale+scaleIndex+1)*scaledImgWidth)*4], scaledImg.Pix[(yScale*scaledImgWidth)*4:(yScale+1)*scaledImgWidth*4])
-				}
-				wg.Done()
+					for scaleIndex := 1; scaleIndex < scale; scaleIndex++ {
+						copy(scaledImg.Pix[((yScale+scaleIndex)*scaledImgWidth)*4:((yScale+scaleIndex+1)*scaledImgWidth)*4], scaledImg.Pix[(yScale*scaledImgWidth)*4:(yScale+1)*scaledImgWidth*4])
+					}
+				}()
 			}
 		}()
 	}
@@ -225,10 +293,14 @@ func (vi *valetudoImage) upscaleToGGContext() {
 
 	// Wait for all workers to finish
 	wg.Wait()
+	if p.err != nil {
+		return p.err
+	}
 
 	vi.ggContext = gg.NewContextForRGBA(scaledImg)
 	vi.scaledImgWidth = scaledImgWidth
 	vi.scaledImgHeight = scaledImgHeight
+	return nil
 }
 
 type rotationFunc func(x, y int) (int, int)
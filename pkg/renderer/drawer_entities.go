@@ -1,5 +1,7 @@
 package renderer
 
+const goToTargetRadius = 2.0 // In map pixels
+
 // Entities coordinates are basically same as layers coordinates, just multiplied by
 // vi.valetudoJSON.PixelSize value, so simply divide by it and we get their coords at
 // 1x scale. Then we can upscale to our scale integer.
@@ -11,36 +13,74 @@ func (vi *valetudoImage) entityToImageCoords(vacuumX, vacuumY int) (float64, flo
 }
 
 func (vi *valetudoImage) drawEntityVirtualWall(e *Entity) {
+	if len(e.Points) < 4 {
+		return
+	}
 	sx, sy := vi.entityToImageCoords(e.Points[0], e.Points[1])
 	ex, ey := vi.entityToImageCoords(e.Points[2], e.Points[3])
 	vi.ggContext.DrawLine(sx, sy, ex, ey)
 }
 
-func (vi *valetudoImage) drawEntityNoGoArea(e *Entity) {
-	sx, sy := vi.entityToImageCoords(e.Points[0], e.Points[1])
-	ex, ey := vi.entityToImageCoords(e.Points[4], e.Points[5])
+// Area entities (no_go_area, no_mop_area, active_zone) are polygons, usually
+// rectangles of 4 points.
+func (vi *valetudoImage) drawEntityArea(e *Entity) {
+	if len(e.Points) < 6 {
+		return
+	}
+	x, y := vi.entityToImageCoords(e.Points[0], e.Points[1])
+	vi.ggContext.NewSubPath()
+	vi.ggContext.MoveTo(x, y)
+	for i := 2; i+1 < len(e.Points); i += 2 {
+		x, y = vi.entityToImageCoords(e.Points[i], e.Points[i+1])
+		vi.ggContext.LineTo(x, y)
+	}
+	vi.ggContext.ClosePath()
+}
 
-	width := ex - sx
-	height := ey - sy
-	vi.ggContext.DrawRectangle(sx, sy, width, height)
+func (vi *valetudoImage) drawEntityGoToTarget(e *Entity) {
+	if len(e.Points) < 2 {
+		return
+	}
+	x, y := vi.entityToImageCoords(e.Points[0], e.Points[1])
+	scale := vi.renderer.settings.Scale
+	radius := goToTargetRadius * scale
+
+	// Crosshair: circle with lines sticking out of it and a dot in the middle
+	vi.ggContext.DrawCircle(x, y, radius)
+	vi.ggContext.DrawLine(x-radius*1.5, y, x-radius*0.5, y)
+	vi.ggContext.DrawLine(x+radius*0.5, y, x+radius*1.5, y)
+	vi.ggContext.DrawLine(x, y-radius*1.5, x, y-radius*0.5)
+	vi.ggContext.DrawLine(x, y+radius*0.5, x, y+radius*1.5)
+	vi.ggContext.Stroke()
+	vi.ggContext.DrawCircle(x, y, scale*0.5)
+	vi.ggContext.Fill()
 }
 
 func (vi *valetudoImage) drawEntityPath(e *Entity) {
+	if len(e.Points) < 2 {
+		return
+	}
 	sx, sy := vi.entityToImageCoords(e.Points[0], e.Points[1])
 	vi.ggContext.MoveTo(sx, sy)
-	for i := 2; i < len(e.Points); i += 2 {
+	for i := 2; i+1 < len(e.Points); i += 2 {
 		currX, currY := vi.entityToImageCoords(e.Points[i], e.Points[i+1])
 		vi.ggContext.LineTo(currX, currY)
 	}
 }
 
 func (vi *valetudoImage) drawEntityRobot(e *Entity, xOffset, yOffset int) {
+	if len(e.Points) < 2 {
+		return
+	}
 	coordX, coordY := vi.entityToImageCoords(e.Points[0], e.Points[1])
-	angle := (int(e.MetaData.Angle) + (vi.renderer.settings.RotationTimes * 90)) % 360
+	angle := ((int(e.MetaData.Angle)+(vi.renderer.settings.RotationTimes*90))%360 + 360) % 360
 	vi.ggContext.DrawImageAnchored(vi.renderer.assetRobot[angle], int(coordX)+xOffset, int(coordY)+yOffset, 0.5, 0.5)
 }
 
 func (vi *valetudoImage) drawEntityCharger(e *Entity, xOffset, yOffset int) {
+	if len(e.Points) < 2 {
+		return
+	}
 	coordX, coordY := vi.entityToImageCoords(e.Points[0], e.Points[1])
 	vi.ggContext.DrawImageAnchored(vi.renderer.assetCharger, int(coordX)+xOffset, int(coordY)+yOffset, 0.5, 0.5)
 }
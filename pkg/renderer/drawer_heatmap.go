@@ -0,0 +1,43 @@
+package renderer
+
+import "image/color"
+
+// Returns color of the pixel, which robot's path passed over given times, drawn on
+// top of given color.
+func (vi *valetudoImage) heatmapColor(base color.RGBA, passes int) color.RGBA {
+	if passes <= 0 {
+		return base
+	}
+	return blendColors(base, vi.heatmapPassColor(passes))
+}
+
+// Colors form a gradient, where the first one is used for a single pass and the
+// last one - for max passes (or more).
+func (vi *valetudoImage) heatmapPassColor(passes int) color.RGBA {
+	s := vi.renderer.settings
+	colors := s.HeatmapColors
+	if len(colors) == 1 || s.HeatmapMaxPasses <= 1 {
+		return colors[len(colors)-1]
+	}
+
+	pos := float64(min(passes, s.HeatmapMaxPasses)-1) / float64(s.HeatmapMaxPasses-1) * float64(len(colors)-1)
+	i := min(int(pos), len(colors)-2)
+	t := pos - float64(i)
+	from, to := colors[i], colors[i+1]
+	return color.RGBA{
+		R: uint8(float64(from.R) + (float64(to.R)-float64(from.R))*t),
+		G: uint8(float64(from.G) + (float64(to.G)-float64(from.G))*t),
+		B: uint8(float64(from.B) + (float64(to.B)-float64(from.B))*t),
+		A: uint8(float64(from.A) + (float64(to.A)-float64(from.A))*t),
+	}
+}
+
+func blendColors(bottom, top color.RGBA) color.RGBA {
+	a := float64(top.A) / 255
+	return color.RGBA{
+		R: uint8(float64(top.R)*a + float64(bottom.R)*(1-a)),
+		G: uint8(float64(top.G)*a + float64(bottom.G)*(1-a)),
+		B: uint8(float64(top.B)*a + float64(bottom.B)*(1-a)),
+		A: uint8(float64(top.A) + float64(bottom.A)*(1-a)),
+	}
+}
@@ -0,0 +1,116 @@
+package renderer
+
+import (
+	"math"
+)
+
+func (vi *valetudoImage) drawLabels() {
+	s := vi.renderer.settings
+	vi.ggContext.SetFontFace(vi.renderer.fontLabel)
+
+	for _, l := range vi.layers["segment"] {
+		if l.MetaData.Name == "" {
+			continue
+		}
+
+		var x, y int
+		if s.LabelPosition == "inscribed" {
+			x, y = findInscribedPoint(l)
+		} else {
+			x, y = l.Dimensions.X.Mid, l.Dimensions.Y.Mid
+		}
+		imgX, imgY := vi.layerToImageCoords(x, y)
+
+		vi.drawOutlinedString(l.MetaData.Name, imgX, imgY, 0.5, 0.5, s.LabelOutlineWidth)
+	}
+}
+
+// Draws text in label colors using current font face. Outline is drawn by
+// repeating text around the given position.
+func (vi *valetudoImage) drawOutlinedString(text string, x, y, ax, ay float64, w int) {
+	s := vi.renderer.settings
+	col := s.LabelOutlineColor
+	vi.ggContext.SetRGBA255(int(col.R), int(col.G), int(col.B), int(col.A))
+	for dy := -w; dy <= w; dy++ {
+		for dx := -w; dx <= w; dx++ {
+			if (dx == 0 && dy == 0) || dx*dx+dy*dy > w*w {
+				continue
+			}
+			vi.ggContext.DrawStringAnchored(text, x+float64(dx), y+float64(dy), ax, ay)
+		}
+	}
+
+	col = s.LabelColor
+	vi.ggContext.SetRGBA255(int(col.R), int(col.G), int(col.B), int(col.A))
+	vi.ggContext.DrawStringAnchored(text, x, y, ax, ay)
+}
+
+// Layer coordinates point to the top-left corner of the pixel, so the center
+// of the upscaled pixel is returned instead.
+func (vi *valetudoImage) layerToImageCoords(layerX, layerY int) (float64, float64) {
+	rotatedX, rotatedY := vi.RotateLayer(layerX-vi.robotCoords.minX, layerY-vi.robotCoords.minY)
+	scale := vi.renderer.settings.Scale
+	return (float64(rotatedX) + 0.5) * scale, (float64(rotatedY) + 0.5) * scale
+}
+
+// Finds the segment pixel that is the furthest away from segment's edges. This is
+// better than the center for L-shaped rooms, where the center is often outside
+// of the room itself.
+func findInscribedPoint(l *Layer) (int, int) {
+	minX, minY := l.Dimensions.X.Min, l.Dimensions.Y.Min
+	width := l.Dimensions.X.Max - minX + 1
+	height := l.Dimensions.Y.Max - minY + 1
+	if width <= 0 || height <= 0 {
+		return l.Dimensions.X.Mid, l.Dimensions.Y.Mid
+	}
+
+	dist := make([]int, width*height)
+	for i := 0; i+2 < len(l.CompressedPixels); i += 3 {
+		x := l.CompressedPixels[i] - minX
+		y := l.CompressedPixels[i+1] - minY
+		if y < 0 || y >= height {
+			continue
+		}
+		for c := 0; c < l.CompressedPixels[i+2]; c++ {
+			if x+c >= 0 && x+c < width {
+				dist[y*width+x+c] = math.MaxInt32
+			}
+		}
+	}
+
+	// Neighbours outside of the bounding box are treated as outside of the segment
+	get := func(x, y int) int {
+		if x < 0 || y < 0 || x >= width || y >= height {
+			return 0
+		}
+		return dist[y*width+x]
+	}
+
+	// Chessboard distance transform in two passes
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if dist[y*width+x] == 0 {
+				continue
+			}
+			d := dist[y*width+x]
+			d = min(d, get(x-1, y)+1, get(x-1, y-1)+1, get(x, y-1)+1, get(x+1, y-1)+1)
+			dist[y*width+x] = d
+		}
+	}
+	bestX, bestY, best := l.Dimensions.X.Mid, l.Dimensions.Y.Mid, 0
+	for y := height - 1; y >= 0; y-- {
+		for x := width - 1; x >= 0; x-- {
+			if dist[y*width+x] == 0 {
+				continue
+			}
+			d := dist[y*width+x]
+			d = min(d, get(x+1, y)+1, get(x+1, y+1)+1, get(x, y+1)+1, get(x-1, y+1)+1)
+			dist[y*width+x] = d
+			if d >= best {
+				bestX, bestY, best = x+minX, y+minY, d
+			}
+		}
+	}
+
+	return bestX, bestY
+}
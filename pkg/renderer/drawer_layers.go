@@ -7,14 +7,16 @@ import (
 )
 
 type layerColor struct {
-	layer *Layer
-	color color.RGBA
+	layer   *Layer
+	color   color.RGBA
+	heatmap bool // Whether heatmap is drawn on top
 }
 
-func (vi *valetudoImage) drawLayers() {
+func (vi *valetudoImage) drawLayers() error {
 	numWorkers := runtime.NumCPU()
 	layerCh := make(chan layerColor, numWorkers)
 	wg := &sync.WaitGroup{}
+	var p workerPanic
 
 	// Start the workers
 	for i := 0; i < numWorkers; i++ {
@@ -22,25 +24,29 @@ func (vi *valetudoImage) drawLayers() {
 		go func() {
 			defer wg.Done()
 			for lc := range layerCh {
-				vi.drawLayer(lc.layer, lc.color)
+				// Keep draining the channel, so sender is never blocked
+				func() {
+					defer p.recover()
+					vi.drawLayer(lc.layer, lc.color, lc.heatmap)
+				}()
 			}
 		}()
 	}
 
 	// Send layers to the channel
+	heatmap := vi.passes != nil
 	col := vi.renderer.settings.FloorColor
 	for _, l := range vi.layers["floor"] {
-		layerCh <- layerColor{l, col}
+		layerCh <- layerColor{l, col, heatmap}
 	}
 
 	col = vi.renderer.settings.ObstacleColor
 	for _, l := range vi.layers["wall"] {
-		layerCh <- layerColor{l, col}
+		layerCh <- layerColor{l, col, false}
 	}
 
 	for _, l := range vi.layers["segment"] {
-		col = vi.segmentColor[l.MetaData.SegmentId]
-		layerCh <- layerColor{l, col}
+		layerCh <- layerColor{l, vi.segmentLayerColor(l), heatmap}
 	}
 
 	// Close the channel to signal the workers to stop
@@ -48,17 +54,31 @@ func (vi *valetudoImage) drawLayers() {
 
 	// Wait for all workers to finish
 	wg.Wait()
+	return p.err
 }
 
-func (vi *valetudoImage) drawLayer(l *Layer, col color.RGBA) {
-	for i := 0; i < len(l.CompressedPixels); i += 3 {
+// In heatmap "replace" mode, segments are drawn as floor
+func (vi *valetudoImage) segmentLayerColor(l *Layer) color.RGBA {
+	if vi.passes != nil && vi.renderer.settings.HeatmapMode == "replace" {
+		return vi.renderer.settings.FloorColor
+	}
+	return vi.segmentColor[l.MetaData.SegmentId]
+}
+
+func (vi *valetudoImage) drawLayer(l *Layer, col color.RGBA, heatmap bool) {
+	for i := 0; i+2 < len(l.CompressedPixels); i += 3 {
 		drawX := l.CompressedPixels[i] - vi.robotCoords.minX
 		drawY := l.CompressedPixels[i+1] - vi.robotCoords.minY
 		count := l.CompressedPixels[i+2]
 
 		for c := 0; c < count; c++ {
 			x, y := vi.RotateLayer(drawX+c, drawY)
-			vi.img.SetRGBA(x, y, col)
+			if heatmap {
+				passes := vi.passes.At(l.CompressedPixels[i]+c, l.CompressedPixels[i+1])
+				vi.img.SetRGBA(x, y, vi.heatmapColor(col, passes))
+			} else {
+				vi.img.SetRGBA(x, y, col)
+			}
 		}
 	}
 }
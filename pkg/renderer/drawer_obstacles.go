@@ -0,0 +1,71 @@
+package renderer
+
+import (
+	"image"
+	"strings"
+)
+
+const (
+	obstacleIconSize  = 6.0  // In map pixels
+	obstacleDotRadius = 1.25 // In map pixels
+)
+
+type obstacleMarker struct {
+	*ObstacleMarker
+	icon    image.Image // Scaled icon, nil if colored dot is drawn instead
+	iconPNG []byte      // Original icon, used for SVG
+}
+
+// Returns marker and short label of obstacle, or nil if obstacle should not be drawn.
+func (vi *valetudoImage) obstacleMarker(e *Entity) (*obstacleMarker, string) {
+	s := vi.renderer.settings
+	if len(e.Points) < 2 {
+		return nil, ""
+	}
+	class, confidence := e.Obstacle()
+	if confidence > 0 && confidence < s.ObstacleMinConfidence {
+		return nil, ""
+	}
+
+	m, found := vi.renderer.obstacleMarkers[strings.ToLower(class)]
+	if !found {
+		m = &obstacleMarker{ObstacleMarker: &ObstacleMarker{Class: class, Color: s.ObstacleMarkerColor}}
+	}
+	if m.Label != "" {
+		return m, m.Label
+	}
+	return m, class
+}
+
+func (vi *valetudoImage) drawObstacles() {
+	s := vi.renderer.settings
+	for _, e := range vi.entities["obstacle"] {
+		m, label := vi.obstacleMarker(e)
+		if m == nil {
+			continue
+		}
+		x, y := vi.entityToImageCoords(e.Points[0], e.Points[1])
+
+		var bottom float64
+		if m.icon != nil {
+			vi.ggContext.DrawImageAnchored(m.icon, int(x), int(y), 0.5, 0.5)
+			bottom = y + float64(m.icon.Bounds().Dy())/2
+		} else {
+			radius := obstacleDotRadius * s.Scale
+			vi.ggContext.DrawCircle(x, y, radius)
+			col := m.Color
+			vi.ggContext.SetRGBA255(int(col.R), int(col.G), int(col.B), int(col.A))
+			vi.ggContext.FillPreserve()
+			col = s.LabelOutlineColor
+			vi.ggContext.SetRGBA255(int(col.R), int(col.G), int(col.B), int(col.A))
+			vi.ggContext.SetLineWidth(s.Scale * 0.25)
+			vi.ggContext.Stroke()
+			bottom = y + radius
+		}
+
+		if s.ObstacleLabels && label != "" {
+			vi.ggContext.SetFontFace(vi.renderer.fontObstacle)
+			vi.drawOutlinedString(label, x, bottom+s.Scale*0.5, 0.5, 1, 1)
+		}
+	}
+}
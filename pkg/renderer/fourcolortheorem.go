@@ -19,18 +19,19 @@ func newVertex(id string) *vertex {
 	return &vertex{id: id, adjacent: make(map[string]struct{}), color: -1}
 }
 
-func (g *graph) addEdge(id1, id2 string) {
+func (g *graph) addVertex(id string) {
 	if g.vertices == nil {
 		g.vertices = make(map[string]*vertex)
 	}
 
-	if _, ok := g.vertices[id1]; !ok {
-		g.vertices[id1] = newVertex(id1)
+	if _, ok := g.vertices[id]; !ok {
+		g.vertices[id] = newVertex(id)
 	}
+}
 
-	if _, ok := g.vertices[id2]; !ok {
-		g.vertices[id2] = newVertex(id2)
-	}
+func (g *graph) addEdge(id1, id2 string) {
+	g.addVertex(id1)
+	g.addVertex(id2)
 
 	g.vertices[id1].adjacent[id2] = struct{}{}
 	g.vertices[id2].adjacent[id1] = struct{}{}
@@ -77,6 +78,8 @@ func (vi *valetudoImage) findFourColors(fourColors []color.RGBA) {
 	g := graph{}
 
 	for _, layer := range vi.layers["segment"] {
+		// Segments without neighbours must get a color too
+		g.addVertex(layer.MetaData.SegmentId)
 		for _, otherLayer := range vi.layers["segment"] {
 			if layer != otherLayer && areAdjacent(layer, otherLayer, vi.valetudoJSON.PixelSize) {
 				g.addEdge(layer.MetaData.SegmentId, otherLayer.MetaData.SegmentId)
@@ -86,8 +89,9 @@ func (vi *valetudoImage) findFourColors(fourColors []color.RGBA) {
 
 	g.colorVertices()
 
+	// Greedy coloring might need more than 4 colors for odd maps, so reuse them
 	for _, v := range g.vertices {
-		vi.segmentColor[v.id] = fourColors[v.color]
+		vi.segmentColor[v.id] = fourColors[v.color%len(fourColors)]
 	}
 }
 
@@ -2,6 +2,11 @@ package renderer
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type ValetudoJSON struct {
@@ -60,6 +65,59 @@ type Entity struct {
 
 type MetaDataEntity struct {
 	Angle float64 `json:"angle,omitempty"`
+
+	// Obstacle entities only
+	Label      string     `json:"label,omitempty"`
+	Confidence Confidence `json:"confidence,omitempty"`
+}
+
+// Obstacle detection confidence in percents. Producers send it either as a number
+// (0-1 or 0-100) or as a string, such as "85%".
+type Confidence float64
+
+func (c *Confidence) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*c = normalizeConfidence(v)
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(v), "%")), 64)
+		if err != nil {
+			return fmt.Errorf("invalid confidence %q", v)
+		}
+		*c = normalizeConfidence(f)
+	case nil:
+		*c = 0
+	default:
+		return fmt.Errorf("invalid confidence %s", data)
+	}
+	return nil
+}
+
+func normalizeConfidence(f float64) Confidence {
+	if f > 0 && f <= 1 {
+		f *= 100
+	}
+	return Confidence(f)
+}
+
+// Returns obstacle class and confidence (0 if unknown) of obstacle entity. Valetudo
+// sends obstacle label with confidence appended to it, e.g. "Sock (85%)".
+func (e *Entity) Obstacle() (class string, confidence float64) {
+	class, confidence = strings.TrimSpace(e.MetaData.Label), float64(e.MetaData.Confidence)
+	if open := strings.LastIndex(class, "("); open > 0 && strings.HasSuffix(class, ")") {
+		inner := strings.TrimSuffix(strings.TrimSpace(class[open+1:len(class)-1]), "%")
+		if f, err := strconv.ParseFloat(inner, 64); err == nil {
+			class = strings.TrimSpace(class[:open])
+			if confidence == 0 {
+				confidence = float64(normalizeConfidence(f))
+			}
+		}
+	}
+	return class, confidence
 }
 
 func toJSON(payload []byte) (*ValetudoJSON, error) {
@@ -68,5 +126,137 @@ func toJSON(payload []byte) (*ValetudoJSON, error) {
 	if err != nil {
 		return nil, err
 	}
+	if JSON == nil {
+		return nil, errors.New("map data is empty")
+	}
+	if JSON.PixelSize <= 0 {
+		return nil, errors.New("invalid map pixelSize value")
+	}
+	totalArea := 0
+	for i, l := range JSON.Layers {
+		if l == nil {
+			return nil, fmt.Errorf("layer %d is empty", i)
+		}
+		if err := l.normalize(JSON.Size, JSON.PixelSize); err != nil {
+			return nil, fmt.Errorf("invalid %s layer %d: %w", l.Type, i, err)
+		}
+		totalArea += l.MetaData.Area
+	}
+	if JSON.MetaData == nil {
+		JSON.MetaData = &MetaData{}
+	}
+	if JSON.MetaData.TotalLayerArea == 0 {
+		JSON.MetaData.TotalLayerArea = totalArea
+	}
 	return JSON, nil
 }
+
+// Parses and validates Valetudo map JSON. Layers are normalized so that their
+// pixels are always available in CompressedPixels.
+func ParseJSON(payload []byte) (*ValetudoJSON, error) {
+	return toJSON(payload)
+}
+
+// Validates layer pixels and converts plain pixels (x,y pairs), which are sent by
+// older Valetudo versions, to compressed pixels (x,y,count runs).
+func (l *Layer) normalize(size *Size, pixelSize int) error {
+	// Map size is in cm, while pixels are in map pixels. Size is optional.
+	maxX, maxY := -1, -1
+	if size != nil && size.X > 0 && size.Y > 0 {
+		maxX, maxY = (size.X+pixelSize-1)/pixelSize, (size.Y+pixelSize-1)/pixelSize
+	}
+	inBounds := func(x, y int) bool {
+		return x >= 0 && y >= 0 && (maxX < 0 || x < maxX) && (maxY < 0 || y < maxY)
+	}
+
+	if len(l.CompressedPixels) > 0 {
+		if len(l.CompressedPixels)%3 != 0 {
+			return fmt.Errorf("compressedPixels length %d is not a multiple of 3", len(l.CompressedPixels))
+		}
+		count := 0
+		for i := 0; i < len(l.CompressedPixels); i += 3 {
+			x, y, n := l.CompressedPixels[i], l.CompressedPixels[i+1], l.CompressedPixels[i+2]
+			if n <= 0 || !inBounds(x, y) || !inBounds(x+n-1, y) {
+				return fmt.Errorf("compressedPixels run %d,%d,%d is out of bounds", x, y, n)
+			}
+			count += n
+		}
+		l.Pixels = nil
+		l.setArea(count, pixelSize)
+		return nil
+	}
+
+	if len(l.Pixels)%2 != 0 {
+		return fmt.Errorf("pixels length %d is not a multiple of 2", len(l.Pixels))
+	}
+	if len(l.Pixels) == 0 {
+		return nil
+	}
+
+	type pixel struct{ x, y int }
+	pixels := make([]pixel, 0, len(l.Pixels)/2)
+	for i := 0; i < len(l.Pixels); i += 2 {
+		x, y := l.Pixels[i], l.Pixels[i+1]
+		if !inBounds(x, y) {
+			return fmt.Errorf("pixel %d,%d is out of bounds", x, y)
+		}
+		pixels = append(pixels, pixel{x, y})
+	}
+	sort.Slice(pixels, func(i, j int) bool {
+		if pixels[i].y != pixels[j].y {
+			return pixels[i].y < pixels[j].y
+		}
+		return pixels[i].x < pixels[j].x
+	})
+
+	// Merge horizontally adjacent pixels into runs, skipping duplicates
+	compressed := make([]int, 0, len(l.Pixels))
+	count := 0
+	for i, p := range pixels {
+		last := len(compressed) - 3
+		switch {
+		case i > 0 && p == pixels[i-1]:
+			continue
+		case last >= 0 && compressed[last+1] == p.y && compressed[last]+compressed[last+2] == p.x:
+			compressed[last+2]++
+		default:
+			compressed = append(compressed, p.x, p.y, 1)
+		}
+		count++
+	}
+	l.CompressedPixels = compressed
+	l.Pixels = nil
+
+	// Producers of plain pixels do not always send dimensions
+	if l.Dimensions.PixelCount == 0 {
+		l.Dimensions = pixelDimensions(compressed, count)
+	}
+	l.setArea(count, pixelSize)
+	return nil
+}
+
+// Sets layer area (in cm²) if producer did not provide it.
+func (l *Layer) setArea(count, pixelSize int) {
+	if l.MetaData.Area == 0 {
+		l.MetaData.Area = count * pixelSize * pixelSize
+	}
+}
+
+func pixelDimensions(compressed []int, count int) Dimensions {
+	d := Dimensions{
+		X:          Dimension{Min: compressed[0], Max: compressed[0]},
+		Y:          Dimension{Min: compressed[1], Max: compressed[1]},
+		PixelCount: count,
+	}
+	sumX, sumY := 0, 0
+	for i := 0; i < len(compressed); i += 3 {
+		x, y, n := compressed[i], compressed[i+1], compressed[i+2]
+		d.X.Min, d.X.Max = min(d.X.Min, x), max(d.X.Max, x+n-1)
+		d.Y.Min, d.Y.Max = min(d.Y.Min, y), max(d.Y.Max, y)
+		sumX += n*x + n*(n-1)/2
+		sumY += n * y
+	}
+	d.X.Mid, d.Y.Mid = (d.X.Min+d.X.Max)/2, (d.Y.Min+d.Y.Max)/2
+	d.X.Avg, d.Y.Avg = sumX/count, sumY/count
+	return d
+}
@@ -0,0 +1,111 @@
+package renderer
+
+import "math"
+
+// Number of times robot's path passed over every map pixel.
+type PassCounts struct {
+	minX, minY    int
+	width, height int
+	counts        []int
+}
+
+// Rasterizes path entities with given brush width (in robot's coordinates system
+// units) onto map pixels. Consecutive path lines overlap on their joints, so pixel
+// covered by the previous line is only counted again if path turned back.
+func CountPasses(m *ValetudoJSON, brushWidth int) *PassCounts {
+	pc := &PassCounts{}
+	if len(m.Layers) == 0 || m.PixelSize <= 0 {
+		return pc
+	}
+
+	pc.minX, pc.minY = m.Layers[0].Dimensions.X.Min, m.Layers[0].Dimensions.Y.Min
+	maxX, maxY := m.Layers[0].Dimensions.X.Max, m.Layers[0].Dimensions.Y.Max
+	for _, l := range m.Layers[1:] {
+		pc.minX, pc.minY = min(pc.minX, l.Dimensions.X.Min), min(pc.minY, l.Dimensions.Y.Min)
+		maxX, maxY = max(maxX, l.Dimensions.X.Max), max(maxY, l.Dimensions.Y.Max)
+	}
+	pc.width, pc.height = maxX-pc.minX+1, maxY-pc.minY+1
+	if pc.width <= 0 || pc.height <= 0 {
+		pc.width, pc.height = 0, 0
+		return pc
+	}
+	pc.counts = make([]int, pc.width*pc.height)
+
+	// Index of the last line that touched the pixel
+	lastLine := make([]int, len(pc.counts))
+	for i := range lastLine {
+		lastLine[i] = -2
+	}
+
+	pixelSize := float64(m.PixelSize)
+	radius := float64(brushWidth) / 2 / pixelSize
+	line := 0
+	for _, e := range m.Entities {
+		if e.Type != "path" {
+			continue
+		}
+		for i := 0; i+3 < len(e.Points); i += 2 {
+			// Pixel centers are at +0.5, so shift line to match them
+			x1, y1 := float64(e.Points[i])/pixelSize-0.5, float64(e.Points[i+1])/pixelSize-0.5
+			x2, y2 := float64(e.Points[i+2])/pixelSize-0.5, float64(e.Points[i+3])/pixelSize-0.5
+
+			// Turned back if angle between previous and current lines is above 120°
+			turnedBack := false
+			if i >= 2 {
+				prevDX, prevDY := float64(e.Points[i]-e.Points[i-2]), float64(e.Points[i+1]-e.Points[i-1])
+				dx, dy := x2-x1, y2-y1
+				dot := prevDX*dx + prevDY*dy
+				turnedBack = dot < -0.5*math.Hypot(prevDX, prevDY)*math.Hypot(dx, dy)
+			}
+
+			pc.drawLine(lastLine, line, x1, y1, x2, y2, radius, turnedBack)
+			line++
+		}
+		line++ // Separate path entities are separate passes
+	}
+	return pc
+}
+
+func (pc *PassCounts) drawLine(lastLine []int, line int, x1, y1, x2, y2, radius float64, turnedBack bool) {
+	startX := max(int(math.Floor(min(x1, x2)-radius))-pc.minX, 0)
+	endX := min(int(math.Ceil(max(x1, x2)+radius))-pc.minX, pc.width-1)
+	startY := max(int(math.Floor(min(y1, y2)-radius))-pc.minY, 0)
+	endY := min(int(math.Ceil(max(y1, y2)+radius))-pc.minY, pc.height-1)
+
+	dx, dy := x2-x1, y2-y1
+	lengthSq := dx*dx + dy*dy
+	for y := startY; y <= endY; y++ {
+		for x := startX; x <= endX; x++ {
+			px, py := float64(x+pc.minX), float64(y+pc.minY)
+
+			// Distance from pixel to the closest point of the line
+			t := 0.0
+			if lengthSq > 0 {
+				t = math.Max(0, math.Min(1, ((px-x1)*dx+(py-y1)*dy)/lengthSq))
+			}
+			distX, distY := px-(x1+t*dx), py-(y1+t*dy)
+			if distX*distX+distY*distY > radius*radius {
+				continue
+			}
+
+			// Pixel near the joint is still covered by the same pass, even if
+			// path turned back
+			i := y*pc.width + x
+			startX, startY := px-x1, py-y1
+			continued := lastLine[i] == line-1 && (!turnedBack || startX*startX+startY*startY <= radius*radius)
+			if !continued {
+				pc.counts[i]++
+			}
+			lastLine[i] = line
+		}
+	}
+}
+
+// Returns number of passes over given pixel (in layer coordinates).
+func (pc *PassCounts) At(x, y int) int {
+	x, y = x-pc.minX, y-pc.minY
+	if x < 0 || y < 0 || x >= pc.width || y >= pc.height {
+		return 0
+	}
+	return pc.counts[y*pc.width+x]
+}
@@ -1,21 +1,32 @@
 package renderer
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/png"
 	"math"
+	"os"
+	"strings"
 
 	"github.com/erkexzcx/valetudopng"
 	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
 	"golang.org/x/image/math/f64"
 )
 
 type Renderer struct {
-	assetRobot   map[int]image.Image
-	assetCharger image.Image
-	settings     *Settings
+	assetRobot      map[int]image.Image
+	assetCharger    image.Image
+	fontLabel       font.Face
+	fontObstacle    font.Face
+	obstacleMarkers map[string]*obstacleMarker // Lowercase obstacle class to marker
+	settings        *Settings
 }
 
 type Settings struct {
@@ -33,6 +44,45 @@ type Settings struct {
 	NoGoAreaColor    color.RGBA
 	VirtualWallColor color.RGBA
 	SegmentColors    []color.RGBA
+
+	// Zones of running zone cleanup, areas robot must not mop and target of
+	// running go-to command
+	ActiveZoneColor        color.RGBA
+	ActiveZoneOutlineColor color.RGBA
+	NoMopAreaColor         color.RGBA
+	NoMopAreaOutlineColor  color.RGBA
+	GoToTargetColor        color.RGBA
+
+	// Segment (room) names drawn on top of the map
+	LabelsEnabled     bool
+	LabelFont         string // Path to TTF file, embedded Go font is used if empty
+	LabelSize         float64
+	LabelOutlineWidth int
+	LabelPosition     string // "center" or "inscribed"
+	LabelColor        color.RGBA
+	LabelOutlineColor color.RGBA
+
+	// Floor and segment pixels shaded by how many times robot's path passed over them
+	HeatmapEnabled    bool
+	HeatmapMode       string // "overlay" (on top of layer colors) or "replace" (instead of segment colors)
+	HeatmapBrushWidth int    // In robot's coordinates system units
+	HeatmapMaxPasses  int    // Passes count, at which the last color is reached
+	HeatmapColors     []color.RGBA
+
+	// Obstacles detected by robot's AI obstacle avoidance, drawn as icons or dots
+	ObstaclesHidden       bool
+	ObstacleLabels        bool // Draw short label below every obstacle
+	ObstacleLabelSize     float64
+	ObstacleMinConfidence float64    // In percents, obstacles of unknown confidence are always drawn
+	ObstacleMarkerColor   color.RGBA // Used for obstacle classes without own marker
+	ObstacleMarkers       []*ObstacleMarker
+}
+
+type ObstacleMarker struct {
+	Class string // Obstacle label without confidence, e.g. "Sock", case insensitive
+	Label string // Short label, obstacle class is used if empty
+	Color color.RGBA
+	Icon  string // Path to PNG file, drawn instead of colored dot if set
 }
 
 func New(s *Settings) *Renderer {
@@ -52,19 +102,40 @@ func New(s *Settings) *Renderer {
 	}
 	loadAssetRobot(r)
 	loadAssetCharger(r)
+	if s.LabelsEnabled {
+		loadFontLabel(r)
+	}
+	if !s.ObstaclesHidden {
+		loadObstacleMarkers(r)
+	}
 	return r
 }
 
-func (r *Renderer) Render(data []byte, mc *config.MapConfig) (*Result, error) {
+func (r *Renderer) Render(data []byte, mc *config.MapConfig) (res *Result, err error) {
+	// Malformed map data must not bring down the whole service
+	defer func() {
+		if rec := recover(); rec != nil {
+			res, err = nil, fmt.Errorf("recovered from panic while rendering map: %v", rec)
+		}
+	}()
+
 	// Parse data to JSON object
 	JSON, err := toJSON(data)
 	if err != nil {
 		return nil, err
 	}
 
+	// Image size comes from layers, unless custom limits are set
+	st := r.settings
+	if len(JSON.Layers) == 0 && st.StaticStartX == 0 && st.StaticStartY == 0 && st.StaticEndX == 0 && st.StaticEndY == 0 {
+		return nil, errors.New("map has no layers")
+	}
+
 	// Render image
 	vi := newValetudoImage(JSON, r)
-	vi.DrawAll()
+	if err := vi.DrawAll(); err != nil {
+		return nil, err
+	}
 
 	img := vi.ggContext.Image()
 	return &Result{
@@ -82,6 +153,8 @@ func (r *Renderer) Render(data []byte, mc *config.MapConfig) (*Result, error) {
 		Settings:    vi.renderer.settings,
 		Calibration: vi.getCalibrationPointsJSON(),
 		PixelSize:   vi.valetudoJSON.PixelSize,
+		MapData:     vi.valetudoJSON,
+		vi:          vi,
 	}, nil
 }
 
@@ -145,3 +218,62 @@ func loadAssetCharger(r *Renderer) {
 	draw.BiLinear.Scale(scaledImg, scaledImg.Bounds(), img, img.Bounds(), draw.Over, nil)
 	r.assetCharger = scaledImg
 }
+
+func loadFontLabel(r *Renderer) {
+	r.fontLabel = loadFont(r.settings.LabelFont, r.settings.LabelSize)
+}
+
+func loadFont(path string, size float64) font.Face {
+	ttf := goregular.TTF
+	if path != "" {
+		var err error
+		ttf, err = os.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	f, err := truetype.Parse(ttf)
+	if err != nil {
+		panic(err)
+	}
+
+	return truetype.NewFace(f, &truetype.Options{Size: size})
+}
+
+func loadObstacleMarkers(r *Renderer) {
+	if r.settings.ObstacleLabels {
+		r.fontObstacle = loadFont(r.settings.LabelFont, r.settings.ObstacleLabelSize)
+	}
+
+	// Icons are scaled to fit into the square of obstacleIconSize map pixels
+	maxSize := int(obstacleIconSize * r.settings.Scale)
+
+	r.obstacleMarkers = make(map[string]*obstacleMarker, len(r.settings.ObstacleMarkers))
+	for _, m := range r.settings.ObstacleMarkers {
+		marker := &obstacleMarker{ObstacleMarker: m}
+		if m.Icon != "" {
+			data, err := os.ReadFile(m.Icon)
+			if err != nil {
+				panic(err)
+			}
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				panic(fmt.Errorf("invalid obstacle icon %s: %w", m.Icon, err))
+			}
+
+			width, height := img.Bounds().Dx(), img.Bounds().Dy()
+			if width >= height {
+				width, height = maxSize, max(1, height*maxSize/width)
+			} else {
+				width, height = max(1, width*maxSize/height), maxSize
+			}
+			scaledImg := image.NewRGBA(image.Rect(0, 0, width, height))
+			draw.BiLinear.Scale(scaledImg, scaledImg.Bounds(), img, img.Bounds(), draw.Over, nil)
+
+			marker.icon = scaledImg
+			marker.iconPNG = data
+		}
+		r.obstacleMarkers[strings.ToLower(m.Class)] = marker
+	}
+}
@@ -0,0 +1,593 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "regenerate golden files in testdata/golden")
+
+func testSettings() *Settings {
+	return &Settings{
+		Scale:          4,
+		PNGCompression: 0,
+		RotationTimes:  0,
+
+		FloorColor:             color.RGBA{0x00, 0x76, 0xff, 0xff},
+		ObstacleColor:          color.RGBA{0x5d, 0x5d, 0x5d, 0xff},
+		PathColor:              color.RGBA{0xff, 0xff, 0xff, 0xff},
+		NoGoAreaColor:          color.RGBA{0xff, 0x00, 0x00, 0x4a},
+		VirtualWallColor:       color.RGBA{0xff, 0x00, 0x00, 0xbf},
+		NoMopAreaColor:         color.RGBA{0xb0, 0x00, 0xff, 0x4a},
+		NoMopAreaOutlineColor:  color.RGBA{0xb0, 0x00, 0xff, 0xbf},
+		ActiveZoneColor:        color.RGBA{0x00, 0xff, 0x00, 0x40},
+		ActiveZoneOutlineColor: color.RGBA{0x00, 0xc0, 0x00, 0xbf},
+		GoToTargetColor:        color.RGBA{0xff, 0xd7, 0x00, 0xff},
+		SegmentColors: []color.RGBA{
+			{0x19, 0xa1, 0xa1, 0xff},
+			{0x7a, 0xc0, 0x37, 0xff},
+			{0xff, 0x9b, 0x57, 0xff},
+			{0xf7, 0xc8, 0x41, 0xff},
+		},
+
+		LabelSize:         14,
+		LabelOutlineWidth: 2,
+		LabelPosition:     "center",
+		LabelColor:        color.RGBA{0xff, 0xff, 0xff, 0xff},
+		LabelOutlineColor: color.RGBA{0x00, 0x00, 0x00, 0xbf},
+
+		HeatmapMode:       "overlay",
+		HeatmapBrushWidth: 25,
+		HeatmapMaxPasses:  3,
+		HeatmapColors: []color.RGBA{
+			{0xff, 0xff, 0x00, 0x80},
+			{0xff, 0x80, 0x00, 0xa0},
+			{0xff, 0x00, 0x00, 0xc0},
+		},
+	}
+}
+
+func readTestMap(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+var goldenTests = []struct {
+	name   string
+	modify func(s *Settings)
+}{
+	{"rotate0", func(s *Settings) {}},
+	{"rotate1", func(s *Settings) { s.RotationTimes = 1 }},
+	{"rotate2", func(s *Settings) { s.RotationTimes = 2 }},
+	{"rotate3", func(s *Settings) { s.RotationTimes = 3 }},
+	{"scale1", func(s *Settings) { s.Scale = 1 }},
+	{"scale2", func(s *Settings) { s.Scale = 2 }},
+	{"scale7", func(s *Settings) { s.Scale = 7 }},
+	{"custom_limits", func(s *Settings) {
+		s.StaticStartX, s.StaticStartY = 2100, 2100
+		s.StaticEndX, s.StaticEndY = 2400, 2300
+	}},
+	{"custom_limits_rotate1", func(s *Settings) {
+		s.StaticStartX, s.StaticStartY = 2100, 2100
+		s.StaticEndX, s.StaticEndY = 2400, 2300
+		s.RotationTimes = 1
+	}},
+	{"custom_limits_rotate3", func(s *Settings) {
+		s.StaticStartX, s.StaticStartY = 2100, 2100
+		s.StaticEndX, s.StaticEndY = 2400, 2300
+		s.RotationTimes = 3
+	}},
+	{"labels_center", func(s *Settings) { s.LabelsEnabled = true }},
+	{"labels_inscribed_rotate1", func(s *Settings) {
+		s.LabelsEnabled = true
+		s.LabelPosition = "inscribed"
+		s.RotationTimes = 1
+	}},
+	{"heatmap_overlay", func(s *Settings) { s.HeatmapEnabled = true }},
+	{"heatmap_replace_rotate1", func(s *Settings) {
+		s.HeatmapEnabled = true
+		s.HeatmapMode = "replace"
+		s.RotationTimes = 1
+	}},
+}
+
+// Rendered images and calibration data are compared against files in testdata/golden.
+// Run "go test ./pkg/renderer -update" to regenerate them after intended changes.
+func TestRenderGolden(t *testing.T) {
+	data := readTestMap(t, "map.json")
+
+	for _, tt := range goldenTests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testSettings()
+			tt.modify(s)
+
+			res, err := New(s).Render(data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := res.RenderPNG()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenPNG := filepath.Join("testdata", "golden", tt.name+".png")
+			goldenCalibration := filepath.Join("testdata", "golden", tt.name+".json")
+			if *update {
+				if err := os.WriteFile(goldenPNG, img, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(goldenCalibration, res.Calibration, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			expectedCalibration, err := os.ReadFile(goldenCalibration)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(res.Calibration, expectedCalibration) {
+				t.Errorf("calibration mismatch:\n got: %s\nwant: %s", res.Calibration, expectedCalibration)
+			}
+
+			expectedPNG, err := os.ReadFile(goldenPNG)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := compareImages(img, expectedPNG); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Both images are compared as decoded PNGs, because PNG stores non-premultiplied
+// colors and conversion from premultiplied ones is lossy.
+func compareImages(gotPNG, expectedPNG []byte) error {
+	got, err := png.Decode(bytes.NewReader(gotPNG))
+	if err != nil {
+		return err
+	}
+	expected, err := png.Decode(bytes.NewReader(expectedPNG))
+	if err != nil {
+		return err
+	}
+	if got.Bounds() != expected.Bounds() {
+		return fmt.Errorf("image size mismatch: got %v, want %v", got.Bounds(), expected.Bounds())
+	}
+
+	diff := 0
+	var firstX, firstY int
+	b := got.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.NRGBAModel.Convert(got.At(x, y)) != color.NRGBAModel.Convert(expected.At(x, y)) {
+				if diff == 0 {
+					firstX, firstY = x, y
+				}
+				diff++
+			}
+		}
+	}
+	if diff > 0 {
+		return fmt.Errorf("%d pixels differ, first at (%d,%d): got %v, want %v",
+			diff, firstX, firstY, got.At(firstX, firstY), expected.At(firstX, firstY))
+	}
+	return nil
+}
+
+func TestSegmentColors(t *testing.T) {
+	data := readTestMap(t, "map.json")
+	s := testSettings()
+
+	res, err := New(s).Render(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vi := res.vi
+
+	segments := vi.layers["segment"]
+	if len(segments) == 0 {
+		t.Fatal("test map has no segments")
+	}
+	for _, l := range segments {
+		col, found := vi.segmentColor[l.MetaData.SegmentId]
+		if !found {
+			t.Errorf("segment %s has no color", l.MetaData.SegmentId)
+		}
+		for _, other := range segments {
+			if l != other && areAdjacent(l, other, vi.valetudoJSON.PixelSize) && col == vi.segmentColor[other.MetaData.SegmentId] {
+				t.Errorf("adjacent segments %s and %s have the same color", l.MetaData.SegmentId, other.MetaData.SegmentId)
+			}
+		}
+	}
+}
+
+func TestRenderMalformed(t *testing.T) {
+	// Expected error is a substring of the error message, empty if rendering must succeed
+	tests := map[string]struct {
+		data string
+		err  string
+	}{
+		"empty":            {`null`, "map data is empty"},
+		"no pixel size":    {`{"layers":[],"entities":[]}`, "invalid map pixelSize value"},
+		"invalid JSON":     {`{"pixelSize":5,`, "unexpected end of JSON input"},
+		"short entities":   {`{"pixelSize":5,"layers":[{"type":"floor","compressedPixels":[1,2,1],"dimensions":{"x":{"min":1,"max":1},"y":{"min":2,"max":2}}}],"entities":[{"type":"no_go_area","points":[1,2]},{"type":"virtual_wall","points":[1]},{"type":"path","points":[1,2,3]},{"type":"robot_position","points":[]},{"type":"charger_location","points":[]}]}`, ""},
+		"negative angle":   {`{"pixelSize":5,"layers":[{"type":"floor","compressedPixels":[1,1,1],"dimensions":{"x":{"min":1,"max":1},"y":{"min":1,"max":1}}}],"entities":[{"type":"robot_position","points":[5,5],"metaData":{"angle":-90}}]}`, ""},
+		"isolated segment": {`{"pixelSize":5,"layers":[{"type":"segment","metaData":{"segmentId":"1"},"compressedPixels":[1,1,1],"dimensions":{"x":{"min":1,"max":1},"y":{"min":1,"max":1}}}],"entities":[]}`, ""},
+		"no layers":        {`{"pixelSize":5,"layers":[],"entities":[{"type":"path","points":[5,5,10,10]}]}`, "map has no layers"},
+	}
+
+	r := New(testSettings())
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := r.Render([]byte(tt.data), nil)
+			if tt.err != "" {
+				if err == nil {
+					t.Fatalf("got no error, want %q", tt.err)
+				}
+				if strings.Contains(err.Error(), "recovered from panic") || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %q, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := res.RenderPNG(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := res.RenderSVG(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// Image size does not depend on layers with custom limits
+	s := testSettings()
+	s.StaticStartX, s.StaticStartY = 2100, 2100
+	s.StaticEndX, s.StaticEndY = 2400, 2300
+	res, err := New(s).Render([]byte(tests["no layers"].data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res.RenderPNG(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDrawWorkerPanic(t *testing.T) {
+	m, err := toJSON([]byte(`{"pixelSize":5,"layers":[{"type":"floor","compressedPixels":[1,1,1],"dimensions":{"x":{"min":1,"max":1},"y":{"min":1,"max":1}}}],"entities":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Panics inside worker goroutines are returned instead of crashing
+	vi := newValetudoImage(m, New(testSettings()))
+	vi.img = nil
+	if err := vi.drawLayers(); err == nil || !strings.Contains(err.Error(), "recovered from panic") {
+		t.Fatalf("got error %v from layer workers, want recovered panic", err)
+	}
+	if err := vi.upscaleToGGContext(); err == nil || !strings.Contains(err.Error(), "recovered from panic") {
+		t.Fatalf("got error %v from upscale workers, want recovered panic", err)
+	}
+}
+
+func TestCountPasses(t *testing.T) {
+	// Path points are in the middle of pixels: right along y=10, down to y=15,
+	// then back up and left
+	m := &ValetudoJSON{
+		PixelSize: 10,
+		Layers: []*Layer{{
+			Type:       "floor",
+			Dimensions: Dimensions{X: Dimension{Min: 0, Max: 19}, Y: Dimension{Min: 0, Max: 19}},
+		}},
+		Entities: []*Entity{{
+			Type:   "path",
+			Points: []int{55, 105, 155, 105, 155, 155, 155, 105, 55, 105},
+		}},
+	}
+	pc := CountPasses(m, 30)
+
+	tests := []struct {
+		x, y int
+		want int
+	}{
+		{7, 10, 2},  // Passed there and back
+		{15, 13, 2}, // Passed down and back up
+		{15, 16, 1}, // Single pass, despite overlapping lines on the joint
+		{7, 13, 0},  // Outside of brush width
+		{25, 10, 0}, // Outside of the map
+	}
+	for _, tt := range tests {
+		if got := pc.At(tt.x, tt.y); got != tt.want {
+			t.Errorf("pixel %d,%d: got %d passes, want %d", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestRenderPlainPixels(t *testing.T) {
+	data := readTestMap(t, "map.json")
+	expected, err := toJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Convert test map to older format with plain pixels and no dimensions or areas
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	m["metaData"].(map[string]any)["totalLayerArea"] = 0
+	for _, l := range m["layers"].([]any) {
+		layer := l.(map[string]any)
+		compressed := layer["compressedPixels"].([]any)
+		pixels := make([]int, 0)
+		for i := 0; i < len(compressed); i += 3 {
+			x, y, count := int(compressed[i].(float64)), int(compressed[i+1].(float64)), int(compressed[i+2].(float64))
+			for c := count - 1; c >= 0; c-- {
+				pixels = append(pixels, x+c, y)
+			}
+		}
+		layer["pixels"] = pixels
+		delete(layer, "compressedPixels")
+		delete(layer, "dimensions")
+		delete(layer["metaData"].(map[string]any), "area")
+	}
+	data, err = json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := New(testSettings()).Render(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totalArea := 0
+	for i, l := range res.MapData.Layers {
+		want := expected.Layers[i]
+		got, wantPixels := pixelSet(l.CompressedPixels), pixelSet(want.CompressedPixels)
+		if !reflect.DeepEqual(got, wantPixels) {
+			t.Errorf("layer %d: got different pixels", i)
+		}
+		if l.Dimensions.PixelCount != len(got) || l.MetaData.Area != len(got)*25 ||
+			l.Dimensions.X.Min != want.Dimensions.X.Min || l.Dimensions.X.Max != want.Dimensions.X.Max ||
+			l.Dimensions.Y.Min != want.Dimensions.Y.Min || l.Dimensions.Y.Max != want.Dimensions.Y.Max {
+			t.Errorf("layer %d: got area %d, dimensions %+v, want dimensions %+v", i, l.MetaData.Area, l.Dimensions, want.Dimensions)
+		}
+		totalArea += l.MetaData.Area
+	}
+	if res.MapData.MetaData.TotalLayerArea != totalArea {
+		t.Errorf("got total area %d, want %d", res.MapData.MetaData.TotalLayerArea, totalArea)
+	}
+
+	img, err := res.RenderPNG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPNG, err := os.ReadFile(filepath.Join("testdata", "golden", "rotate0.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareImages(img, expectedPNG); err != nil {
+		t.Error(err)
+	}
+}
+
+func pixelSet(compressed []int) map[[2]int]bool {
+	pixels := make(map[[2]int]bool)
+	for i := 0; i+2 < len(compressed); i += 3 {
+		for c := 0; c < compressed[i+2]; c++ {
+			pixels[[2]int{compressed[i] + c, compressed[i+1]}] = true
+		}
+	}
+	return pixels
+}
+
+func TestParseInvalidPixels(t *testing.T) {
+	tests := map[string]string{
+		"odd pixels":                 `{"pixelSize":5,"layers":[{"type":"floor","pixels":[1,2,3]}]}`,
+		"negative pixel":             `{"pixelSize":5,"layers":[{"type":"floor","pixels":[1,-2]}]}`,
+		"pixel outside map":          `{"pixelSize":5,"size":{"x":100,"y":100},"layers":[{"type":"floor","pixels":[20,2]}]}`,
+		"short compressed pixels":    `{"pixelSize":5,"layers":[{"type":"floor","compressedPixels":[1,2,3,4]}]}`,
+		"empty run":                  `{"pixelSize":5,"layers":[{"type":"floor","compressedPixels":[1,2,0]}]}`,
+		"run outside map":            `{"pixelSize":5,"size":{"x":100,"y":100},"layers":[{"type":"floor","compressedPixels":[15,2,6]}]}`,
+		"negative compressed pixels": `{"pixelSize":5,"layers":[{"type":"floor","compressedPixels":[-1,2,3]}]}`,
+		"null layer":                 `{"pixelSize":5,"layers":[null]}`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseJSON([]byte(data)); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+
+	// Last pixel on the edge of the map is still valid
+	if _, err := ParseJSON([]byte(`{"pixelSize":5,"size":{"x":100,"y":100},"layers":[{"type":"floor","compressedPixels":[15,19,5]}]}`)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEntityObstacle(t *testing.T) {
+	tests := []struct {
+		metaData   string
+		class      string
+		confidence float64
+	}{
+		{`{"label":"Sock (85%)"}`, "Sock", 85},
+		{`{"label":"Pet waste"}`, "Pet waste", 0},
+		{`{"label":"Cable","confidence":0.4}`, "Cable", 40},
+		{`{"label":"Shoe","confidence":"90%"}`, "Shoe", 90},
+		{`{"label":"Cable (0.5)","confidence":70}`, "Cable", 70},
+		{`{"label":"Power strip (unknown)"}`, "Power strip (unknown)", 0},
+	}
+	for _, tt := range tests {
+		var e Entity
+		if err := json.Unmarshal([]byte(`{"type":"obstacle","points":[0,0],"metaData":`+tt.metaData+`}`), &e); err != nil {
+			t.Fatal(err)
+		}
+		class, confidence := e.Obstacle()
+		if class != tt.class || confidence != tt.confidence {
+			t.Errorf("%s: got %q (%g), want %q (%g)", tt.metaData, class, confidence, tt.class, tt.confidence)
+		}
+	}
+}
+
+func TestRenderObstacles(t *testing.T) {
+	var m map[string]any
+	if err := json.Unmarshal(readTestMap(t, "map.json"), &m); err != nil {
+		t.Fatal(err)
+	}
+	m["entities"] = append(m["entities"].([]any),
+		map[string]any{"type": "obstacle", "points": []int{2300, 2150}, "metaData": map[string]any{"label": "Sock (85%)"}},
+		map[string]any{"type": "obstacle", "points": []int{2400, 2250}, "metaData": map[string]any{"label": "Cable", "confidence": 0.4}},
+		map[string]any{"type": "obstacle", "points": []int{2350, 2050}, "metaData": map[string]any{"label": "Shoe (90%)"}},
+	)
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sockColor := color.RGBA{0xff, 0x00, 0xff, 0xff}
+	cableColor := color.RGBA{0x00, 0xff, 0x00, 0xff}
+	render := func(modify func(s *Settings)) (*Result, []byte) {
+		t.Helper()
+		s := testSettings()
+		s.ObstacleLabels = true
+		s.ObstacleLabelSize = 10
+		s.ObstacleMinConfidence = 50
+		s.ObstacleMarkerColor = cableColor
+		s.ObstacleMarkers = []*ObstacleMarker{
+			{Class: "sock", Label: "S", Color: sockColor},
+			{Class: "Shoe", Icon: filepath.Join("..", "..", "res", "charger.png")},
+		}
+		modify(s)
+		res, err := New(s).Render(data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := res.RenderPNG()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, img
+	}
+	colorAt := func(img []byte, x, y int) color.Color {
+		t.Helper()
+		decoded, err := png.Decode(bytes.NewReader(img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return color.RGBAModel.Convert(decoded.At(x, y))
+	}
+
+	// Map starts at 409,409 map pixels (5 cm) and is drawn at scale 4
+	res, img := render(func(s *Settings) {})
+	if got := colorAt(img, 204, 84); got != sockColor {
+		t.Errorf("got %v at sock marker, want %v", got, sockColor)
+	}
+	if got := colorAt(img, 284, 164); got == cableColor {
+		t.Error("got cable below min confidence drawn")
+	}
+	svg, err := res.RenderSVG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<circle cx="204" cy="84"`, `>S</text>`, `>Shoe</text>`, `<image x="`} {
+		if !bytes.Contains(svg, []byte(want)) {
+			t.Errorf("SVG does not contain %s", want)
+		}
+	}
+	if bytes.Contains(svg, []byte(`>Cable</text>`)) {
+		t.Error("SVG contains cable below min confidence")
+	}
+
+	_, img = render(func(s *Settings) { s.ObstacleMinConfidence = 0 })
+	if got := colorAt(img, 284, 164); got != cableColor {
+		t.Errorf("got %v at cable marker, want %v", got, cableColor)
+	}
+
+	res, img = render(func(s *Settings) { s.ObstaclesHidden = true })
+	if got := colorAt(img, 204, 84); got == sockColor {
+		t.Error("got hidden obstacle drawn")
+	}
+	if svg, err = res.RenderSVG(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(svg, []byte("<circle")) {
+		t.Error("SVG contains hidden obstacle")
+	}
+}
+
+func TestRenderZonesAndTargets(t *testing.T) {
+	var m map[string]any
+	if err := json.Unmarshal(readTestMap(t, "map.json"), &m); err != nil {
+		t.Fatal(err)
+	}
+	m["entities"] = append(m["entities"].([]any),
+		map[string]any{"type": "no_mop_area", "points": []int{2060, 2060, 2150, 2060, 2150, 2150, 2060, 2150}},
+		map[string]any{"type": "active_zone", "points": []int{2300, 2310, 2350, 2310, 2350, 2340, 2300, 2340}},
+		map[string]any{"type": "go_to_target", "points": []int{2100, 2250}},
+	)
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Opaque colors, so they can be compared without blending
+	s := testSettings()
+	s.NoMopAreaColor = color.RGBA{0xb0, 0x00, 0xff, 0xff}
+	s.ActiveZoneColor = color.RGBA{0x00, 0xff, 0x00, 0xff}
+	res, err := New(s).Render(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := res.RenderPNG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Map starts at 409,409 map pixels (5 cm) and is drawn at scale 4
+	points := []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		{"no_mop_area", 48, 48, s.NoMopAreaColor},
+		{"active_zone", 224, 224, s.ActiveZoneColor},
+		{"go_to_target", 44, 164, s.GoToTargetColor},
+	}
+	for _, p := range points {
+		if got := color.RGBAModel.Convert(decoded.At(p.x, p.y)); got != p.want {
+			t.Errorf("%s: got %v, want %v", p.name, got, p.want)
+		}
+	}
+
+	svg, err := res.RenderSVG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`fill="#b000ff" stroke="#b000ff"`, `stroke-dasharray="`, `fill="#00ff00" stroke="#00c000"`, `<circle cx="44" cy="164"`} {
+		if !bytes.Contains(svg, []byte(want)) {
+			t.Errorf("SVG does not contain %s", want)
+		}
+	}
+}
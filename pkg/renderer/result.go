@@ -2,6 +2,7 @@ package renderer
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"image/png"
 )
@@ -16,6 +17,9 @@ type Result struct {
 	Settings    *Settings
 	Calibration []byte
 	PixelSize   int // taken from JSON, for traslating image coords to robot's coords system coordinates
+	MapData     *ValetudoJSON
+
+	vi *valetudoImage // for rendering other formats (e.g. SVG) on demand
 }
 
 type ImgSize struct {
@@ -30,9 +34,15 @@ type RbtCoords struct {
 	MaxY int
 }
 
-func (r *Result) RenderPNG() ([]byte, error) {
+func (r *Result) RenderPNG() (img []byte, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			img, err = nil, fmt.Errorf("recovered from panic while encoding PNG: %v", rec)
+		}
+	}()
+
 	var b bytes.Buffer
-	err := pngEncoder.Encode(&b, *r.Image)
+	err = pngEncoder.Encode(&b, *r.Image)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,371 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+
+	"github.com/erkexzcx/valetudopng"
+)
+
+type svgRect struct {
+	x, y, width, height int
+}
+
+func (r *Result) RenderSVG() (svg []byte, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			svg, err = nil, fmt.Errorf("recovered from panic while rendering SVG: %v", rec)
+		}
+	}()
+
+	vi := r.vi
+	s := vi.renderer.settings
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		vi.scaledImgWidth, vi.scaledImgHeight, vi.scaledImgWidth, vi.scaledImgHeight)
+
+	// Draw layers
+	for _, l := range vi.layers["floor"] {
+		vi.writeSVGLayer(&b, l, s.FloorColor)
+	}
+	for _, l := range vi.layers["wall"] {
+		vi.writeSVGLayer(&b, l, s.ObstacleColor)
+	}
+	for _, l := range vi.layers["segment"] {
+		vi.writeSVGLayer(&b, l, vi.segmentLayerColor(l))
+	}
+	if vi.passes != nil {
+		for _, l := range vi.layers["floor"] {
+			vi.writeSVGHeatmap(&b, l)
+		}
+		for _, l := range vi.layers["segment"] {
+			vi.writeSVGHeatmap(&b, l)
+		}
+	}
+
+	// Draw path entity
+	for _, e := range vi.entities["path"] {
+		if len(e.Points) < 2 {
+			continue
+		}
+		b.WriteString(`<path fill="none" stroke-linecap="round" stroke-linejoin="round" `)
+		writeSVGStroke(&b, s.PathColor, s.Scale*0.75)
+		b.WriteString(` d="`)
+		for i := 0; i+1 < len(e.Points); i += 2 {
+			x, y := vi.entityToImageCoords(e.Points[i], e.Points[i+1])
+			if i == 0 {
+				fmt.Fprintf(&b, "M%g %g", x, y)
+			} else {
+				fmt.Fprintf(&b, "L%g %g", x, y)
+			}
+		}
+		b.WriteString("\"/>\n")
+	}
+
+	// Draw virtual_wall entities
+	for _, e := range vi.entities["virtual_wall"] {
+		if len(e.Points) < 4 {
+			continue
+		}
+		sx, sy := vi.entityToImageCoords(e.Points[0], e.Points[1])
+		ex, ey := vi.entityToImageCoords(e.Points[2], e.Points[3])
+		fmt.Fprintf(&b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke-linecap="butt" `, sx, sy, ex, ey)
+		writeSVGStroke(&b, s.VirtualWallColor, s.Scale*1.5)
+		b.WriteString("/>\n")
+	}
+
+	// Draw area entities
+	vi.writeSVGAreas(&b, "no_mop_area", s.NoMopAreaColor, s.NoMopAreaOutlineColor, true)
+	vi.writeSVGAreas(&b, "no_go_area", s.NoGoAreaColor, s.VirtualWallColor, false)
+	vi.writeSVGAreas(&b, "active_zone", s.ActiveZoneColor, s.ActiveZoneOutlineColor, false)
+
+	// Draw go_to_target entity
+	for _, e := range vi.entities["go_to_target"] {
+		if len(e.Points) < 2 {
+			continue
+		}
+		x, y := vi.entityToImageCoords(e.Points[0], e.Points[1])
+		radius := goToTargetRadius * s.Scale
+		b.WriteString(`<g fill="none" `)
+		writeSVGStroke(&b, s.GoToTargetColor, s.Scale*0.5)
+		fmt.Fprintf(&b, `><circle cx="%g" cy="%g" r="%g"/><path d="M%g %gH%gM%g %gH%gM%g %gV%gM%g %gV%g"/></g>`,
+			x, y, radius,
+			x-radius*1.5, y, x-radius*0.5, x+radius*0.5, y, x+radius*1.5,
+			x, y-radius*1.5, y-radius*0.5, x, y+radius*0.5, y+radius*1.5)
+		fmt.Fprintf(&b, `<circle cx="%g" cy="%g" r="%g" `, x, y, s.Scale*0.5)
+		writeSVGFill(&b, s.GoToTargetColor)
+		b.WriteString("/>\n")
+	}
+
+	// Draw obstacle entities
+	if !s.ObstaclesHidden {
+		vi.writeSVGObstacles(&b)
+	}
+
+	// Draw charger_location entity
+	for _, e := range vi.entities["charger_location"] {
+		if len(e.Points) < 2 {
+			continue
+		}
+		x, y := vi.entityToImageCoords(e.Points[0], e.Points[1])
+		if err := writeSVGAsset(&b, "res/charger.png", x, y, s.Scale, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	// Draw robot_position entity
+	for _, e := range vi.entities["robot_position"] {
+		if len(e.Points) < 2 {
+			continue
+		}
+		x, y := vi.entityToImageCoords(e.Points[0], e.Points[1])
+		angle := ((int(e.MetaData.Angle)+(s.RotationTimes*90))%360 + 360) % 360
+		if err := writeSVGAsset(&b, "res/robot.png", x+float64(int(s.Scale)/2), y-1, s.Scale, angle); err != nil {
+			return nil, err
+		}
+	}
+
+	// Draw segment names
+	if s.LabelsEnabled {
+		for _, l := range vi.layers["segment"] {
+			if l.MetaData.Name == "" {
+				continue
+			}
+			var x, y int
+			if s.LabelPosition == "inscribed" {
+				x, y = findInscribedPoint(l)
+			} else {
+				x, y = l.Dimensions.X.Mid, l.Dimensions.Y.Mid
+			}
+			imgX, imgY := vi.layerToImageCoords(x, y)
+			fmt.Fprintf(&b, `<text x="%g" y="%g" text-anchor="middle" dominant-baseline="central" font-family="sans-serif" font-size="%g" paint-order="stroke" stroke-linejoin="round" `, imgX, imgY, s.LabelSize)
+			writeSVGFill(&b, s.LabelColor)
+			if s.LabelOutlineWidth > 0 {
+				b.WriteString(` `)
+				writeSVGStroke(&b, s.LabelOutlineColor, float64(s.LabelOutlineWidth*2))
+			}
+			b.WriteString(`>`)
+			b.WriteString(escapeSVGText(l.MetaData.Name))
+			b.WriteString("</text>\n")
+		}
+	}
+
+	b.WriteString("</svg>\n")
+	return b.Bytes(), nil
+}
+
+// Layer pixels are stored as horizontal runs, so runs of the same X and width on
+// consecutive rows are merged into rectangles to keep the amount of SVG elements low.
+func (vi *valetudoImage) writeSVGLayer(w io.Writer, l *Layer, col color.RGBA) {
+	rects := make([]*svgRect, 0)
+	open := make(map[[2]int]*svgRect) // [x, width] to rect ending on previous row
+	lastY := 0
+	for i := 0; i+2 < len(l.CompressedPixels); i += 3 {
+		x := l.CompressedPixels[i] - vi.robotCoords.minX
+		y := l.CompressedPixels[i+1] - vi.robotCoords.minY
+		count := l.CompressedPixels[i+2]
+		if count <= 0 {
+			continue
+		}
+
+		if y != lastY {
+			for k, r := range open {
+				if r.y+r.height < y {
+					delete(open, k)
+				}
+			}
+			lastY = y
+		}
+
+		key := [2]int{x, count}
+		if r, found := open[key]; found && r.y+r.height == y {
+			r.height++
+			continue
+		}
+		r := &svgRect{x, y, count, 1}
+		open[key] = r
+		rects = append(rects, r)
+	}
+	if len(rects) == 0 {
+		return
+	}
+
+	scale := int(vi.renderer.settings.Scale)
+	io.WriteString(w, `<path `)
+	writeSVGFill(w, col)
+	io.WriteString(w, ` d="`)
+	for _, r := range rects {
+		x1, y1 := vi.RotateLayer(r.x, r.y)
+		x2, y2 := vi.RotateLayer(r.x+r.width-1, r.y+r.height-1)
+		x1, x2 = min(x1, x2), max(x1, x2)
+		y1, y2 = min(y1, y2), max(y1, y2)
+		fmt.Fprintf(w, "M%d %dh%dv%dh%dz", x1*scale, y1*scale, (x2-x1+1)*scale, (y2-y1+1)*scale, -(x2-x1+1)*scale)
+	}
+	io.WriteString(w, "\"/>\n")
+}
+
+// Heatmap is drawn as semi-transparent runs on top of the layer, one path per
+// passes count.
+func (vi *valetudoImage) writeSVGHeatmap(w io.Writer, l *Layer) {
+	runs := make(map[int][]*svgRect)
+	maxPasses := 0
+	for i := 0; i+2 < len(l.CompressedPixels); i += 3 {
+		x := l.CompressedPixels[i]
+		y := l.CompressedPixels[i+1]
+		count := l.CompressedPixels[i+2]
+
+		start, startPasses := 0, vi.passes.At(x, y)
+		for c := 1; c <= count; c++ {
+			passes := 0
+			if c < count {
+				passes = vi.passes.At(x+c, y)
+			}
+			if c < count && passes == startPasses {
+				continue
+			}
+			if startPasses > 0 {
+				r := &svgRect{x + start - vi.robotCoords.minX, y - vi.robotCoords.minY, c - start, 1}
+				runs[startPasses] = append(runs[startPasses], r)
+				maxPasses = max(maxPasses, startPasses)
+			}
+			start, startPasses = c, passes
+		}
+	}
+
+	scale := int(vi.renderer.settings.Scale)
+	for passes := 1; passes <= maxPasses; passes++ {
+		if len(runs[passes]) == 0 {
+			continue
+		}
+		io.WriteString(w, `<path `)
+		writeSVGFill(w, vi.heatmapPassColor(passes))
+		io.WriteString(w, ` d="`)
+		for _, r := range runs[passes] {
+			x1, y1 := vi.RotateLayer(r.x, r.y)
+			x2, y2 := vi.RotateLayer(r.x+r.width-1, r.y)
+			x1, x2 = min(x1, x2), max(x1, x2)
+			y1, y2 = min(y1, y2), max(y1, y2)
+			fmt.Fprintf(w, "M%d %dh%dv%dh%dz", x1*scale, y1*scale, (x2-x1+1)*scale, (y2-y1+1)*scale, -(x2-x1+1)*scale)
+		}
+		io.WriteString(w, "\"/>\n")
+	}
+}
+
+func (vi *valetudoImage) writeSVGAreas(w io.Writer, entityType string, fill, outline color.RGBA, dashed bool) {
+	lineWidth := vi.renderer.settings.Scale * 0.5
+	for _, e := range vi.entities[entityType] {
+		if len(e.Points) < 6 {
+			continue
+		}
+		io.WriteString(w, `<polygon `)
+		writeSVGFill(w, fill)
+		io.WriteString(w, ` `)
+		writeSVGStroke(w, outline, lineWidth)
+		if dashed {
+			fmt.Fprintf(w, ` stroke-dasharray="%g %g"`, lineWidth*4, lineWidth*2)
+		}
+		io.WriteString(w, ` points="`)
+		for i := 0; i+1 < len(e.Points); i += 2 {
+			x, y := vi.entityToImageCoords(e.Points[i], e.Points[i+1])
+			if i > 0 {
+				io.WriteString(w, " ")
+			}
+			fmt.Fprintf(w, "%g,%g", x, y)
+		}
+		io.WriteString(w, "\"/>\n")
+	}
+}
+
+func (vi *valetudoImage) writeSVGObstacles(w io.Writer) {
+	s := vi.renderer.settings
+	for _, e := range vi.entities["obstacle"] {
+		m, label := vi.obstacleMarker(e)
+		if m == nil {
+			continue
+		}
+		x, y := vi.entityToImageCoords(e.Points[0], e.Points[1])
+
+		var bottom float64
+		if m.icon != nil {
+			width, height := float64(m.icon.Bounds().Dx()), float64(m.icon.Bounds().Dy())
+			fmt.Fprintf(w, `<image x="%g" y="%g" width="%g" height="%g" href="data:image/png;base64,%s"/>`+"\n",
+				x-width/2, y-height/2, width, height, base64.StdEncoding.EncodeToString(m.iconPNG))
+			bottom = y + height/2
+		} else {
+			radius := obstacleDotRadius * s.Scale
+			fmt.Fprintf(w, `<circle cx="%g" cy="%g" r="%g" `, x, y, radius)
+			writeSVGFill(w, m.Color)
+			io.WriteString(w, ` `)
+			writeSVGStroke(w, s.LabelOutlineColor, s.Scale*0.25)
+			io.WriteString(w, "/>\n")
+			bottom = y + radius
+		}
+
+		if s.ObstacleLabels && label != "" {
+			fmt.Fprintf(w, `<text x="%g" y="%g" text-anchor="middle" dominant-baseline="hanging" font-family="sans-serif" font-size="%g" paint-order="stroke" stroke-linejoin="round" `,
+				x, bottom+s.Scale*0.5, s.ObstacleLabelSize)
+			writeSVGFill(w, s.LabelColor)
+			io.WriteString(w, ` `)
+			writeSVGStroke(w, s.LabelOutlineColor, 2)
+			io.WriteString(w, `>`)
+			io.WriteString(w, escapeSVGText(label))
+			io.WriteString(w, "</text>\n")
+		}
+	}
+}
+
+func writeSVGAsset(w io.Writer, path string, x, y, scale float64, angle int) error {
+	data, err := valetudopng.ResFS.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	width, height, err := pngSize(data)
+	if err != nil {
+		return err
+	}
+
+	// Assets are designed for scale 4
+	scaledWidth := float64(width) * scale / 4
+	scaledHeight := float64(height) * scale / 4
+	fmt.Fprintf(w, `<image x="%g" y="%g" width="%g" height="%g"`, x-scaledWidth/2, y-scaledHeight/2, scaledWidth, scaledHeight)
+	if angle != 0 {
+		fmt.Fprintf(w, ` transform="rotate(%d %g %g)"`, angle, x, y)
+	}
+	fmt.Fprintf(w, ` href="data:image/png;base64,%s"/>`+"\n", base64.StdEncoding.EncodeToString(data))
+	return nil
+}
+
+func pngSize(data []byte) (int, int, error) {
+	// Width and height are the first fields of IHDR chunk, which always goes first
+	if len(data) < 24 {
+		return 0, 0, fmt.Errorf("invalid PNG asset")
+	}
+	width := int(data[16])<<24 | int(data[17])<<16 | int(data[18])<<8 | int(data[19])
+	height := int(data[20])<<24 | int(data[21])<<16 | int(data[22])<<8 | int(data[23])
+	return width, height, nil
+}
+
+func writeSVGFill(w io.Writer, col color.RGBA) {
+	fmt.Fprintf(w, `fill="#%02x%02x%02x"`, col.R, col.G, col.B)
+	if col.A != 255 {
+		fmt.Fprintf(w, ` fill-opacity="%.3g"`, float64(col.A)/255)
+	}
+}
+
+func writeSVGStroke(w io.Writer, col color.RGBA, width float64) {
+	fmt.Fprintf(w, `stroke="#%02x%02x%02x" stroke-width="%g"`, col.R, col.G, col.B, width)
+	if col.A != 255 {
+		fmt.Fprintf(w, ` stroke-opacity="%.3g"`, float64(col.A)/255)
+	}
+}
+
+var svgTextReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
+func escapeSVGText(s string) string {
+	return svgTextReplacer.Replace(s)
+}
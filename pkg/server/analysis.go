@@ -0,0 +1,23 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/erkexzcx/valetudopng/pkg/history"
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+// Map analysis panic is turned into an error, so malformed map does not bring
+// down the whole service.
+func recoverAnalysis(err *error) {
+	if rec := recover(); rec != nil {
+		*err = fmt.Errorf("recovered from panic while analyzing map: %v", rec)
+	}
+}
+
+func updateTracker(t *history.Tracker, mi *mapinfo.MapInfo, m *renderer.ValetudoJSON, payload, img []byte) (s *history.Session, sessionImg []byte, err error) {
+	defer recoverAnalysis(&err)
+	s, sessionImg = t.Update(mi, m, payload, img)
+	return s, sessionImg, nil
+}
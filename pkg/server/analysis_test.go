@@ -0,0 +1,17 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/erkexzcx/valetudopng/pkg/history"
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
+)
+
+func TestUpdateTrackerPanic(t *testing.T) {
+	var tracker *history.Tracker
+	_, _, err := updateTracker(tracker, &mapinfo.MapInfo{}, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "recovered from panic") {
+		t.Fatalf("got error %v, want recovered panic", err)
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mapdiff"
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+// Compares every map against pinned reference map. Layers barely change while
+// robot is cleaning, so maps are only compared again once layers or reference
+// change. Reference can be re-pinned via HTTP, so access is guarded.
+type mapDiffer struct {
+	mux           sync.Mutex
+	referencePath string
+	settings      *mapdiff.Settings
+
+	reference     *renderer.ValetudoJSON
+	referenceHash uint64
+	lastPayload   []byte
+	lastMap       *renderer.ValetudoJSON
+	lastHash      uint64
+	lastDiff      *mapdiff.Diff
+	diffHashes    [2]uint64     // Layers hashes of map and reference lastDiff is of
+	publishedDiff *mapdiff.Diff // Last diff returned as changed by update
+}
+
+var differ *mapDiffer // Nil if map diff is disabled
+
+func newMapDiffer(c *config.Config) (*mapDiffer, error) {
+	md := &mapDiffer{
+		referencePath: c.MapDiff.Reference,
+		settings: &mapdiff.Settings{
+			MinArea:       c.MapDiff.MinArea,
+			Scale:         int(c.Map.Scale),
+			RotationTimes: c.Map.RotationTimes,
+
+			FloorColor:        HexColor(c.MapDiff.Colors.Floor),
+			WallColor:         HexColor(c.MapDiff.Colors.Wall),
+			FloorAddedColor:   HexColor(c.MapDiff.Colors.FloorAdded),
+			FloorRemovedColor: HexColor(c.MapDiff.Colors.FloorRemoved),
+			WallAddedColor:    HexColor(c.MapDiff.Colors.WallAdded),
+		},
+	}
+
+	payload, err := os.ReadFile(md.referencePath)
+	if os.IsNotExist(err) {
+		return md, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	md.reference, err = mapdiff.ParseReference(payload)
+	if err != nil {
+		return nil, err
+	}
+	md.referenceHash = mapdiff.LayersHash(md.reference)
+	return md, nil
+}
+
+// Returns diff of given map against reference and whether it differs from the
+// one returned last time. If there is no reference yet, given map is pinned.
+func (md *mapDiffer) update(payload []byte, m *renderer.ValetudoJSON) (*mapdiff.Diff, bool, error) {
+	md.mux.Lock()
+	defer md.mux.Unlock()
+
+	md.lastPayload, md.lastMap, md.lastHash = payload, m, mapdiff.LayersHash(m)
+	if md.reference == nil {
+		log.Println("Pinning current map as map diff reference")
+		if err := md.pinLast(); err != nil {
+			return nil, false, err
+		}
+	}
+	diff, err := md.compareLast()
+	if err != nil {
+		return nil, false, err
+	}
+	changed := diff != md.publishedDiff
+	md.publishedDiff = diff
+	return diff, changed, nil
+}
+
+// Pins the last map as reference.
+func (md *mapDiffer) pin() (*mapdiff.Diff, error) {
+	md.mux.Lock()
+	defer md.mux.Unlock()
+
+	if md.lastMap == nil {
+		return nil, errors.New("map not yet loaded")
+	}
+	if err := md.pinLast(); err != nil {
+		return nil, err
+	}
+	return md.compareLast()
+}
+
+func (md *mapDiffer) pinLast() error {
+	if err := writeFileAtomic(md.referencePath, md.lastPayload); err != nil {
+		return err
+	}
+	md.reference, md.referenceHash = md.lastMap, md.lastHash
+	return nil
+}
+
+// Compares last map against reference, unless they were already compared.
+func (md *mapDiffer) compareLast() (*mapdiff.Diff, error) {
+	hashes := [2]uint64{md.lastHash, md.referenceHash}
+	if md.lastDiff != nil && md.diffHashes == hashes {
+		return md.lastDiff, nil
+	}
+	diff, err := mapdiff.Compare(md.lastMap, md.reference, md.settings)
+	if err != nil {
+		return nil, err
+	}
+	md.lastDiff, md.diffHashes = diff, hashes
+	return diff, nil
+}
+
+func (md *mapDiffer) getLastDiff() *mapdiff.Diff {
+	md.mux.Lock()
+	defer md.mux.Unlock()
+	return md.lastDiff
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mapdiff"
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+func TestMapDifferCache(t *testing.T) {
+	payload, err := os.ReadFile("../renderer/testdata/map.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse := func() *renderer.ValetudoJSON {
+		t.Helper()
+		m, err := mapdiff.ParseReference(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	c := &config.Config{Map: &config.MapConfig{Scale: 1}, MapDiff: &config.MapDiffConfig{
+		Enabled:   true,
+		Reference: filepath.Join(t.TempDir(), "reference.json"),
+	}}
+	c.MapDiff.Colors.Floor, c.MapDiff.Colors.Wall = "#c0c0c0", "#5d5d5d"
+	c.MapDiff.Colors.FloorAdded, c.MapDiff.Colors.FloorRemoved, c.MapDiff.Colors.WallAdded = "#00c000", "#ff9b00", "#ff0000"
+	md, err := newMapDiffer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// First map is pinned as reference
+	first, changed, err := md.update(payload, parse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || first.Changed {
+		t.Errorf("got changed %v, diff changed %v for the first map", changed, first.Changed)
+	}
+	if _, err := os.Stat(c.MapDiff.Reference); err != nil {
+		t.Error(err)
+	}
+
+	// Only entities changed
+	m := parse()
+	m.Entities = nil
+	diff, changed, err := md.update(payload, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || diff != first {
+		t.Error("got map compared again with unchanged layers")
+	}
+
+	// Segment renamed
+	m = parse()
+	m.Layers[2].MetaData.Name = "Dining room"
+	diff, changed, err = md.update(payload, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || !diff.Changed {
+		t.Errorf("got changed %v, diff changed %v for renamed segment", changed, diff.Changed)
+	}
+
+	// Re-pinned reference is published with the next map
+	if _, err := md.pin(); err != nil {
+		t.Fatal(err)
+	}
+	diff, changed, err = md.update(payload, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || diff.Changed {
+		t.Errorf("got changed %v, diff changed %v after pinning", changed, diff.Changed)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"sync"
+	"time"
+
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+// Sent to HTTP stream clients every time a new image is rendered.
+type mapUpdate struct {
+	result     *renderer.Result
+	png        []byte
+	renderedAt time.Time
+
+	// Encoded once and shared between all MJPEG stream clients
+	jpegOnce sync.Once
+	jpeg     []byte
+	jpegErr  error
+}
+
+// JPEG has no alpha channel, so map is drawn on opaque background first -
+// otherwise transparent background becomes black, hiding walls and path.
+func (u *mapUpdate) getJPEG(quality int, background color.RGBA) ([]byte, error) {
+	u.jpegOnce.Do(func() {
+		src := *u.result.Image
+		img := image.NewRGBA(src.Bounds())
+		background.A = 255
+		draw.Draw(img, img.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+		draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Over)
+
+		var b bytes.Buffer
+		u.jpegErr = jpeg.Encode(&b, img, &jpeg.Options{Quality: quality})
+		u.jpeg = b.Bytes()
+	})
+	return u.jpeg, u.jpegErr
+}
+
+type broadcaster struct {
+	mux         sync.Mutex
+	subscribers map[chan *mapUpdate]struct{}
+	latest      *mapUpdate
+}
+
+var updates = &broadcaster{subscribers: make(map[chan *mapUpdate]struct{})}
+
+// Latest update (if any) is immediately available in returned channel.
+func (b *broadcaster) subscribe() chan *mapUpdate {
+	ch := make(chan *mapUpdate, 1)
+	b.mux.Lock()
+	b.subscribers[ch] = struct{}{}
+	if b.latest != nil {
+		ch <- b.latest
+	}
+	b.mux.Unlock()
+	return ch
+}
+
+func (b *broadcaster) unsubscribe(ch chan *mapUpdate) {
+	b.mux.Lock()
+	delete(b.subscribers, ch)
+	b.mux.Unlock()
+}
+
+// Never blocks. Slow subscribers only receive the latest update.
+func (b *broadcaster) publish(u *mapUpdate) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.latest = u
+	for ch := range b.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- u
+	}
+}
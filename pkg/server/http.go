@@ -2,20 +2,38 @@ package server
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/erkexzcx/valetudopng"
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/mapdiff"
 )
 
-func runWebServer(bind string) {
+func runWebServer(c *config.HTTPConfig) {
 	http.HandleFunc("/api/map/image", requestHandlerImage)
+	http.HandleFunc("/api/map/image.svg", requestHandlerImageSVG)
+	http.HandleFunc("/api/map/events", requestHandlerEvents)
+	http.HandleFunc("/api/map/summary", requestHandlerSummary)
+	http.HandleFunc("/api/map/diff", requestHandlerDiff)
+	http.HandleFunc("/api/map/diff/image", requestHandlerDiffImage)
+	http.HandleFunc("/api/map/diff/pin", requestHandlerDiffPin)
+	http.HandleFunc("/api/status", requestHandlerStatus)
+	http.HandleFunc("/api/history", requestHandlerHistory)
+	http.HandleFunc("/api/history/", requestHandlerHistorySession)
+	http.HandleFunc("/api/map/stream.mjpeg", func(w http.ResponseWriter, r *http.Request) {
+		requestHandlerMJPEG(w, r, c)
+	})
 	http.HandleFunc("/api/map/image/debug", requestHandlerDebug)
 	http.HandleFunc("/api/map/image/debug/static/", requestHandlerDebugStatic)
-	panic(http.ListenAndServe(bind, nil))
+	panic(http.ListenAndServe(c.Bind, nil))
 }
 
 func isResultNotReady() bool {
@@ -41,6 +59,322 @@ func requestHandlerImage(w http.ResponseWriter, r *http.Request) {
 	w.Write(imageCopy)
 }
 
+func requestHandlerImageSVG(w http.ResponseWriter, r *http.Request) {
+	if isResultNotReady() {
+		http.Error(w, "image not yet loaded", http.StatusAccepted)
+		return
+	}
+
+	renderedPNGMux.RLock()
+	res := result
+	svg := renderedSVG
+	renderedPNGMux.RUnlock()
+
+	// SVG is rendered only once per result, when it's requested for the first time
+	if svg == nil {
+		var err error
+		svg, err = res.RenderSVG()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		renderedPNGMux.Lock()
+		if result == res {
+			renderedSVG = svg
+		}
+		renderedPNGMux.Unlock()
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(svg)))
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.WriteHeader(200)
+	w.Write(svg)
+}
+
+func requestHandlerSummary(w http.ResponseWriter, r *http.Request) {
+	if isResultNotReady() {
+		http.Error(w, "image not yet loaded", http.StatusAccepted)
+		return
+	}
+
+	renderedPNGMux.RLock()
+	jsonData, err := json.Marshal(mapInfo)
+	renderedPNGMux.RUnlock()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(jsonData)
+}
+
+func requestHandlerHistory(w http.ResponseWriter, r *http.Request) {
+	if sessions == nil {
+		http.Error(w, "history is disabled", http.StatusNotFound)
+		return
+	}
+
+	jsonData, err := json.Marshal(sessions.List())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(jsonData)
+}
+
+// Handles "/api/history/<id>" (session details), "/api/history/<id>/image" and
+// "/api/history/<id>/timelapse.gif". ID "latest" refers to the last session.
+func requestHandlerHistorySession(w http.ResponseWriter, r *http.Request) {
+	if sessions == nil {
+		http.Error(w, "history is disabled", http.StatusNotFound)
+		return
+	}
+
+	id, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/history/"), "/")
+	if id == "latest" {
+		list := sessions.List()
+		if len(list) == 0 {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		id = list[0].ID
+	}
+
+	switch resource {
+	case "":
+		s, err := sessions.Get(id)
+		if err != nil {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		jsonData, err := json.Marshal(s)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(jsonData)
+	case "image":
+		img, err := sessions.Image(id)
+		if err != nil {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(200)
+		w.Write(img)
+	case "timelapse.gif":
+		gif, err := sessions.Timelapse(id)
+		if err != nil {
+			http.Error(w, "time-lapse not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(gif)))
+		w.Header().Set("Content-Type", "image/gif")
+		w.WriteHeader(200)
+		w.Write(gif)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func requestHandlerDiff(w http.ResponseWriter, r *http.Request) {
+	if differ == nil {
+		http.Error(w, "map diff is disabled", http.StatusNotFound)
+		return
+	}
+	diff := differ.getLastDiff()
+	if diff == nil {
+		http.Error(w, "map not yet loaded", http.StatusAccepted)
+		return
+	}
+	writeDiffJSON(w, diff)
+}
+
+func requestHandlerDiffImage(w http.ResponseWriter, r *http.Request) {
+	if differ == nil {
+		http.Error(w, "map diff is disabled", http.StatusNotFound)
+		return
+	}
+	diff := differ.getLastDiff()
+	if diff == nil {
+		http.Error(w, "map not yet loaded", http.StatusAccepted)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(diff.Image)))
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(200)
+	w.Write(diff.Image)
+}
+
+// Pins current map as the new reference and returns the new diff
+func requestHandlerDiffPin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if differ == nil {
+		http.Error(w, "map diff is disabled", http.StatusNotFound)
+		return
+	}
+	diff, err := differ.pin()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeDiffJSON(w, diff)
+}
+
+func writeDiffJSON(w http.ResponseWriter, diff *mapdiff.Diff) {
+	jsonData, err := json.Marshal(diff)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(jsonData)
+}
+
+func requestHandlerStatus(w http.ResponseWriter, r *http.Request) {
+	jsonData, err := getRenderStatusJSON()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(jsonData)
+}
+
+type eventData struct {
+	RenderedAt  time.Time       `json:"rendered_at"`
+	Width       int             `json:"width"`
+	Height      int             `json:"height"`
+	Size        int             `json:"size"`
+	Calibration json.RawMessage `json:"calibration"`
+	Image       string          `json:"image,omitempty"` // base64 encoded PNG, only if requested
+}
+
+// Server-sent events stream, which notifies about every newly rendered image. Add
+// "?image=true" to receive the image itself (base64 encoded PNG) within the event.
+func requestHandlerEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	withImage, _ := strconv.ParseBool(r.URL.Query().Get("image"))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	ch := updates.subscribe()
+	defer updates.unsubscribe(ch)
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case u := <-ch:
+			data := eventData{
+				RenderedAt:  u.renderedAt,
+				Width:       u.result.ImageSize.Width,
+				Height:      u.result.ImageSize.Height,
+				Size:        len(u.png),
+				Calibration: u.result.Calibration,
+			}
+			if withImage {
+				data.Image = base64.StdEncoding.EncodeToString(u.png)
+			}
+			jsonData, err := json.Marshal(data)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: map\ndata: %s\n\n", jsonData); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// Motion JPEG stream for generic camera consumers (NVRs etc). Latest frame is
+// repeated every keep alive interval, so clients don't time out while robot is docked.
+func requestHandlerMJPEG(w http.ResponseWriter, r *http.Request, c *config.HTTPConfig) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	ch := updates.subscribe()
+	defer updates.unsubscribe(ch)
+
+	keepAlive := time.NewTicker(c.MJPEG.KeepAliveInt)
+	defer keepAlive.Stop()
+
+	background := HexColor(c.MJPEG.Background)
+
+	var latest *mapUpdate
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if latest == nil {
+				continue
+			}
+		case latest = <-ch:
+			keepAlive.Reset(c.MJPEG.KeepAliveInt)
+		}
+
+		frame, err := latest.getJPEG(c.MJPEG.Quality, background)
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame))
+		if err != nil {
+			return
+		}
+		if _, err = w.Write(frame); err != nil {
+			return
+		}
+		if _, err = io.WriteString(w, "\r\n"); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
 type TemplateData struct {
 	RobotMinX    int
 	RobotMinY    int
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+)
+
+func TestMJPEGStream(t *testing.T) {
+	c := &config.HTTPConfig{}
+	c.MJPEG.Quality = 90
+	c.MJPEG.KeepAliveInt = time.Minute
+	c.MJPEG.Background = "#e0e0e0"
+
+	// Transparent map with opaque dark wall on the left half
+	rgba := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 16; x++ {
+			rgba.SetRGBA(x, y, color.RGBA{0x5d, 0x5d, 0x5d, 0xff})
+		}
+	}
+	var img image.Image = rgba
+	updates.publish(&mapUpdate{result: &renderer.Result{Image: &img}, renderedAt: time.Now()})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestHandlerMJPEG(w, r, c)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/x-mixed-replace" {
+		t.Fatalf("got content type %q (%v)", resp.Header.Get("Content-Type"), err)
+	}
+	part, err := multipart.NewReader(resp.Body, params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := part.Header.Get("Content-Type"); ct != "image/jpeg" {
+		t.Fatalf("got frame content type %q", ct)
+	}
+	frame, err := jpeg.Decode(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Bounds() != rgba.Bounds() {
+		t.Fatalf("got frame bounds %v, want %v", frame.Bounds(), rgba.Bounds())
+	}
+
+	// JPEG is lossy, so colors are compared with tolerance
+	near := func(got color.Color, want uint8) bool {
+		r, g, b, _ := got.RGBA()
+		for _, v := range []uint32{r >> 8, g >> 8, b >> 8} {
+			if d := int(v) - int(want); d < -8 || d > 8 {
+				return false
+			}
+		}
+		return true
+	}
+	if got := frame.At(24, 16); !near(got, 0xe0) {
+		t.Errorf("got background %v, want configured background color", got)
+	}
+	if got := frame.At(8, 16); !near(got, 0x5d) {
+		t.Errorf("got wall %v, want wall color", got)
+	}
+}
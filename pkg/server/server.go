@@ -12,80 +12,324 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/erkexzcx/valetudopng/pkg/archive"
 	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/history"
+	"github.com/erkexzcx/valetudopng/pkg/mapdiff"
+	"github.com/erkexzcx/valetudopng/pkg/mapinfo"
 	"github.com/erkexzcx/valetudopng/pkg/mqtt"
+	"github.com/erkexzcx/valetudopng/pkg/mqtt/decoder"
 	"github.com/erkexzcx/valetudopng/pkg/renderer"
 )
 
 var (
 	renderedPNG    = make([]byte, 0)
+	renderedSVG    []byte // Rendered on demand, nil until then
 	renderedPNGMux = &sync.RWMutex{}
 	result         *renderer.Result
+	mapInfo        *mapinfo.MapInfo
+
+	sessions *history.Store // Nil if history is disabled
 )
 
-func Start(c *config.Config) {
-	r := renderer.New(&renderer.Settings{
-		Scale:          c.Map.Scale,
-		PNGCompression: c.Map.PNGCompression,
-		RotationTimes:  c.Map.RotationTimes,
-
-		StaticStartX: c.Map.CustomLimits.StartX,
-		StaticStartY: c.Map.CustomLimits.StartY,
-		StaticEndX:   c.Map.CustomLimits.EndX,
-		StaticEndY:   c.Map.CustomLimits.EndY,
-
-		FloorColor:       HexColor(c.Map.Colors.Floor),
-		ObstacleColor:    HexColor(c.Map.Colors.Obstacle),
-		PathColor:        HexColor(c.Map.Colors.Path),
-		NoGoAreaColor:    HexColor(c.Map.Colors.NoGoArea),
-		VirtualWallColor: HexColor(c.Map.Colors.VirtualWall),
+func NewRenderer(c *config.MapConfig) *renderer.Renderer {
+	heatmapColors := make([]color.RGBA, 0, len(c.Colors.Heatmap))
+	for _, hex := range c.Colors.Heatmap {
+		heatmapColors = append(heatmapColors, HexColor(hex))
+	}
+
+	obstacleMarkers := make([]*renderer.ObstacleMarker, 0, len(c.Obstacles.Markers))
+	for _, m := range c.Obstacles.Markers {
+		obstacleMarkers = append(obstacleMarkers, &renderer.ObstacleMarker{
+			Class: m.Class,
+			Label: m.Label,
+			Color: HexColor(m.Color),
+			Icon:  m.Icon,
+		})
+	}
+
+	return renderer.New(&renderer.Settings{
+		Scale:          c.Scale,
+		PNGCompression: c.PNGCompression,
+		RotationTimes:  c.RotationTimes,
+
+		StaticStartX: c.CustomLimits.StartX,
+		StaticStartY: c.CustomLimits.StartY,
+		StaticEndX:   c.CustomLimits.EndX,
+		StaticEndY:   c.CustomLimits.EndY,
+
+		FloorColor:       HexColor(c.Colors.Floor),
+		ObstacleColor:    HexColor(c.Colors.Obstacle),
+		PathColor:        HexColor(c.Colors.Path),
+		NoGoAreaColor:    HexColor(c.Colors.NoGoArea),
+		VirtualWallColor: HexColor(c.Colors.VirtualWall),
 		SegmentColors: []color.RGBA{
-			HexColor(c.Map.Colors.Segments[0]),
-			HexColor(c.Map.Colors.Segments[1]),
-			HexColor(c.Map.Colors.Segments[2]),
-			HexColor(c.Map.Colors.Segments[3]),
+			HexColor(c.Colors.Segments[0]),
+			HexColor(c.Colors.Segments[1]),
+			HexColor(c.Colors.Segments[2]),
+			HexColor(c.Colors.Segments[3]),
 		},
+
+		ActiveZoneColor:        HexColor(c.Colors.ActiveZone),
+		ActiveZoneOutlineColor: HexColor(c.Colors.ActiveZoneOutline),
+		NoMopAreaColor:         HexColor(c.Colors.NoMopArea),
+		NoMopAreaOutlineColor:  HexColor(c.Colors.NoMopAreaOutline),
+		GoToTargetColor:        HexColor(c.Colors.GoToTarget),
+
+		LabelsEnabled:     c.Labels.Enabled,
+		LabelFont:         c.Labels.Font,
+		LabelSize:         c.Labels.Size,
+		LabelOutlineWidth: *c.Labels.OutlineWidth,
+		LabelPosition:     c.Labels.Position,
+		LabelColor:        HexColor(c.Colors.Label),
+		LabelOutlineColor: HexColor(c.Colors.LabelOutline),
+
+		HeatmapEnabled:    c.Heatmap.Enabled,
+		HeatmapMode:       c.Heatmap.Mode,
+		HeatmapBrushWidth: c.BrushWidth,
+		HeatmapMaxPasses:  c.Heatmap.MaxPasses,
+		HeatmapColors:     heatmapColors,
+
+		ObstaclesHidden:       c.Obstacles.Hide,
+		ObstacleLabels:        *c.Obstacles.Labels,
+		ObstacleLabelSize:     c.Obstacles.LabelSize,
+		ObstacleMinConfidence: c.Obstacles.MinConfidence,
+		ObstacleMarkerColor:   HexColor(c.Colors.ObstacleMarker),
+		ObstacleMarkers:       obstacleMarkers,
+	})
+}
+
+func Start(c *config.Config) {
+	run(c, nil)
+}
+
+// Feeds recorded map payloads through the same render pipeline instead of MQTT
+// consumer. Speed 1 replays in real time, 2 - twice as fast, 0 - without delays.
+func Replay(c *config.Config, path string, speed float64) {
+	run(c, func(mapDataChan chan []byte) {
+		defer close(mapDataChan)
+
+		var prevTs time.Time
+		err := archive.Read(path, func(ts time.Time, payload []byte) error {
+			if speed > 0 && !prevTs.IsZero() && ts.After(prevTs) {
+				time.Sleep(time.Duration(float64(ts.Sub(prevTs)) / speed))
+			}
+			prevTs = ts
+			mapDataChan <- payload
+			return nil
+		})
+		if err != nil {
+			log.Println("Failed to replay archive:", err)
+			return
+		}
+		log.Println("Replay finished")
 	})
+}
+
+// Map data is consumed from MQTT, unless source is provided.
+func run(c *config.Config, source func(mapDataChan chan []byte)) {
+	r := NewRenderer(c.Map)
+	mapInfoSettings := &mapinfo.Settings{
+		RobotSegmentTolerance: *c.Map.RobotSegmentTolerance,
+		BrushWidth:            c.Map.BrushWidth,
+	}
+	replaying := source != nil
+
+	var tracker *history.Tracker
+	var timelapseRenderer *renderer.Renderer
+	var timelapseMapConfig *config.MapConfig
+	if c.History != nil && c.History.Enabled && !replaying {
+		var err error
+		sessions, err = history.NewStore(c.History.Dir, c.History.MaxSessions)
+		if err != nil {
+			log.Fatalln("Failed to open history:", err)
+		}
+
+		maxPayloads := 0
+		if c.History.Timelapse.Enabled {
+			maxPayloads = c.History.Timelapse.MaxFrames
+			timelapseMapConfig = TimelapseMapConfig(c.Map, c.History.Timelapse.Scale)
+			timelapseRenderer = NewRenderer(timelapseMapConfig)
+		}
+		tracker = history.NewTracker(c.History.DockDistance, maxPayloads)
+	}
+
+	if c.MapDiff != nil && c.MapDiff.Enabled && !replaying {
+		var err error
+		differ, err = newMapDiffer(c)
+		if err != nil {
+			log.Fatalln("Failed to load map diff reference:", err)
+		}
+	}
 
 	if c.HTTP.Enabled {
-		go runWebServer(c.HTTP.Bind)
+		go runWebServer(c.HTTP)
 	}
 
-	mapJSONChan := make(chan []byte)
+	mapDataChan := make(chan []byte)
 	renderedMapChan := make(chan []byte)
 	calibrationDataChan := make(chan []byte)
-	go mqtt.Start(c.Mqtt, mapJSONChan, renderedMapChan, calibrationDataChan)
+	renderedSVGChan := make(chan []byte)
+	renderErrorChan := make(chan []byte)
+	mapInfoChan := make(chan *mapinfo.MapInfo)
+	mapDiffChan := make(chan *mapdiff.Diff)
 
-	renderedAt := time.Now().Add(-c.Map.MinRefreshInt)
-	for payload := range mapJSONChan {
-		if time.Now().Before(renderedAt) {
-			log.Println("Skipping image render due to min_refresh_int")
+	var alerts *mapinfo.AlertDetector
+	if c.Alerts != nil && c.Alerts.Enabled {
+		alerts = mapinfo.NewAlertDetector(&mapinfo.AlertSettings{
+			StuckTime:     c.Alerts.StuckTime,
+			StuckDistance: c.Alerts.StuckDistance,
+			DockDistance:  c.Alerts.DockDistance,
+		})
+	}
+
+	var states *stateSaver
+	odometer := mapinfo.NewOdometer(0, 0)
+	if c.StateDir != "" && !replaying {
+		total, pathLength, err := loadOdometer(c.StateDir)
+		if err != nil {
+			log.Println("Failed to load saved odometer:", err)
+		}
+		odometer = mapinfo.NewOdometer(total, pathLength)
+		states = newStateSaver(c.StateDir, stateSaveInt)
+	}
+
+	// Restored map is rendered and published as if it was just received
+	var restored []byte
+	if c.StateDir != "" && !replaying {
+		mapData, err := loadState(c.StateDir)
+		if err != nil {
+			log.Println("Failed to load saved state:", err)
+		} else if mapData != nil {
+			log.Println("Restoring last saved map from", c.StateDir)
+			restored = mapData
+		}
+	}
+
+	if replaying {
+		go mqtt.StartProducer(c.Mqtt, renderedMapChan, calibrationDataChan, renderedSVGChan, renderErrorChan, mapInfoChan, mapDiffChan)
+		go source(mapDataChan)
+	} else {
+		go func() {
+			// Restored map enters the pipeline before consumer is started, so
+			// it can never replace a live map received from broker
+			if restored != nil {
+				mapDataChan <- restored
+			}
+			mqtt.Start(c.Mqtt, mapDataChan, renderedMapChan, calibrationDataChan, renderedSVGChan, renderErrorChan, mapInfoChan, mapDiffChan)
+		}()
+	}
+
+	payloads := throttle(mapDataChan, c.Map.MinRefreshInt)
+	if c.Map.Coalesce {
+		payloads = coalesce(payloads)
+	}
+
+	// Failures are only reported, so the last good image keeps being served
+	for raw := range payloads {
+		payload, err := decoder.Decode(raw)
+		if err != nil {
+			renderErrorChan <- recordRenderFailure("Failed to process raw data:", err)
 			continue
 		}
-		renderedAt = time.Now().Add(c.Map.MinRefreshInt)
 
 		tsStart := time.Now()
 		res, err := r.Render(payload, c.Map)
 		if err != nil {
-			log.Fatalln("Error occurred while rendering map:", err)
+			renderErrorChan <- recordRenderFailure("Error occurred while rendering map:", err)
+			continue
 		}
 		drawnInMS := time.Since(tsStart).Milliseconds()
 
 		img, err := res.RenderPNG()
 		if err != nil {
-			log.Fatalln("Error occurred while rendering PNG image:", err)
+			renderErrorChan <- recordRenderFailure("Error occurred while rendering PNG image:", err)
+			continue
 		}
 		renderedIn := time.Since(tsStart).Milliseconds() - drawnInMS
 
 		log.Printf("Image rendered! drawing:%dms, encoding:%dms, size:%s\n", drawnInMS, renderedIn, ByteCountSI(int64(len(img))))
 
+		// SVG is optional, so its failure must not hold back PNG image
+		var svg []byte
+		if c.Mqtt.PublishSVG {
+			svg, err = res.RenderSVG()
+			if err != nil {
+				renderErrorChan <- recordRenderFailure("Error occurred while rendering SVG image:", err)
+				svg = nil
+			}
+		}
+		recordRenderSuccess()
+
+		if states != nil {
+			states.saveMap(payload)
+		}
+
+		// Analysis walks the same untrusted entities as renderer does
+		mi, diff, err := func() (mi *mapinfo.MapInfo, diff *mapdiff.Diff, err error) {
+			defer recoverAnalysis(&err)
+
+			mi = mapinfo.New(res.MapData, time.Now(), mapInfoSettings)
+			mi.Travel = odometer.Update(mi)
+			if differ != nil {
+				var changed bool
+				diff, changed, err = differ.update(payload, res.MapData)
+				if err != nil {
+					log.Println("Failed to compare map against reference:", err)
+				}
+				if !changed {
+					diff = nil
+				}
+			}
+			if alerts != nil {
+				mi.Alerts = alerts.Update(mi)
+			}
+			return mi, diff, nil
+		}()
+		if err != nil {
+			renderErrorChan <- recordRenderFailure("Error occurred while analyzing map:", err)
+			mi, diff = nil, nil
+		} else if alerts != nil {
+			for _, a := range mi.Alerts {
+				if a.Since.Equal(mi.RenderedAt) {
+					log.Println("Alert raised:", a.Message)
+				}
+			}
+		}
+
+		if states != nil {
+			states.saveOdometer(odometer.State())
+		}
+
 		if !(c.Mqtt.ImageAsBase64 && !c.HTTP.Enabled) {
 			renderedPNGMux.Lock()
 			renderedPNG = img
+			renderedSVG = svg
 			result = res
+			mapInfo = mi
 			renderedPNGMux.Unlock()
 		}
 
+		if tracker != nil && mi != nil {
+			s, sessionImg, err := updateTracker(tracker, mi, res.MapData, payload, img)
+			if err != nil {
+				renderErrorChan <- recordRenderFailure("Error occurred while tracking cleaning session:", err)
+			} else if s != nil {
+				if err := sessions.Save(s, sessionImg); err != nil {
+					log.Println("Failed to save cleaning session:", err)
+				} else {
+					if timelapseRenderer != nil {
+						saveSessionTimelapse(c.History, timelapseRenderer, timelapseMapConfig, s)
+					}
+					log.Printf("Cleaning session %s finished! duration:%ds, distance:%.2fm, area:%.2fm²\n", s.ID, s.Duration, s.Distance, s.Area)
+				}
+			}
+		}
+
+		if c.HTTP.Enabled {
+			updates.publish(&mapUpdate{result: res, png: img, renderedAt: time.Now()})
+		}
+
 		if c.Mqtt.ImageAsBase64 {
 			img = []byte(base64.StdEncoding.EncodeToString(img))
 		}
@@ -93,6 +337,15 @@ func Start(c *config.Config) {
 		// Send data to MQTT
 		renderedMapChan <- img
 		calibrationDataChan <- res.Calibration
+		if svg != nil {
+			renderedSVGChan <- svg
+		}
+		if mi != nil {
+			mapInfoChan <- mi
+		}
+		if diff != nil {
+			mapDiffChan <- diff
+		}
 	}
 
 	// Create a channel to wait for OS interrupt signal
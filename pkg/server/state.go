@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	stateFileMapData  = "map.json"
+	stateFileOdometer = "odometer.json"
+
+	// Map data changes every few seconds while robot is cleaning
+	stateSaveInt = time.Minute
+)
+
+type odometerState struct {
+	Total      float64 `json:"total"`
+	PathLength float64 `json:"path_length"`
+}
+
+// Returns last saved (decoded) map data, or nil if there is none.
+func loadState(dir string) ([]byte, error) {
+	mapData, err := os.ReadFile(filepath.Join(dir, stateFileMapData))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return mapData, err
+}
+
+// Half-written file must never replace the good one (e.g. when killed mid-write)
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Saves last rendered map data and odometer to state directory, so they can be
+// restored after restart instead of waiting (possibly for hours) for robot to
+// publish new map data. Image and calibration are not saved, as restored map is
+// rendered again (with current settings) and published on startup. Distance
+// travelled must keep growing across restarts, as it's used for tracking wear
+// (e.g. by Home Assistant utility meters).
+//
+// Writes are limited, so SD cards are not worn out by rewriting files after
+// every render. Unchanged data is not written at all, while changed data is
+// written at most once per interval - the latest one, when interval ends. Up to
+// one interval of changes is lost if service is killed.
+type stateSaver struct {
+	dir      string
+	interval time.Duration
+
+	mux       sync.Mutex
+	saved     map[string][]byte // Last written data of every file
+	pending   map[string][]byte // Data waiting for interval to end
+	lastWrite time.Time
+	timer     *time.Timer
+}
+
+func newStateSaver(dir string, interval time.Duration) *stateSaver {
+	s := &stateSaver{
+		dir:      dir,
+		interval: interval,
+		saved:    make(map[string][]byte),
+		pending:  make(map[string][]byte),
+	}
+
+	// Files already on disk (e.g. restored ones) are not rewritten unless changed
+	for _, name := range []string{stateFileMapData, stateFileOdometer} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			s.saved[name] = data
+		}
+	}
+	return s
+}
+
+func (s *stateSaver) saveMap(mapData []byte) {
+	s.save(stateFileMapData, mapData)
+}
+
+func (s *stateSaver) saveOdometer(total, pathLength float64) {
+	data, err := json.Marshal(&odometerState{total, pathLength})
+	if err != nil {
+		log.Println("Failed to save odometer:", err)
+		return
+	}
+	s.save(stateFileOdometer, data)
+}
+
+func (s *stateSaver) save(name string, data []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if bytes.Equal(data, s.saved[name]) {
+		delete(s.pending, name)
+		return
+	}
+	s.pending[name] = data
+
+	if s.timer != nil {
+		return
+	}
+	if wait := s.interval - time.Since(s.lastWrite); wait > 0 {
+		s.timer = time.AfterFunc(wait, s.flush)
+		return
+	}
+	s.write()
+}
+
+func (s *stateSaver) flush() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.timer = nil
+	s.write()
+}
+
+// Must be called with mux held.
+func (s *stateSaver) write() {
+	if len(s.pending) == 0 {
+		return
+	}
+	s.lastWrite = time.Now()
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		log.Println("Failed to save state:", err)
+		return
+	}
+	for name, data := range s.pending {
+		if err := writeFileAtomic(filepath.Join(s.dir, name), data); err != nil {
+			log.Println("Failed to save state:", err)
+			continue
+		}
+		s.saved[name] = data
+		delete(s.pending, name)
+	}
+}
+
+// Returns zero values if odometer was never saved.
+func loadOdometer(dir string) (total, pathLength float64, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, stateFileOdometer))
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var state odometerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0, 0, err
+	}
+	return state.Total, state.PathLength, nil
+}
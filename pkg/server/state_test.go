@@ -0,0 +1,77 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestState(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+
+	mapData, err := loadState(dir)
+	if err != nil || mapData != nil {
+		t.Fatalf("got %q, %v without saved state", mapData, err)
+	}
+
+	s := newStateSaver(dir, 0)
+	s.saveMap([]byte(`{"pixelSize":5}`))
+	s.saveOdometer(12.5, 3)
+	mapData, err = loadState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(mapData) != `{"pixelSize":5}` {
+		t.Errorf("got %q", mapData)
+	}
+	total, pathLength, err := loadOdometer(dir)
+	if err != nil || total != 12.5 || pathLength != 3 {
+		t.Errorf("got odometer %v, %v, %v", total, pathLength, err)
+	}
+
+	// Only map data and odometer are kept, everything else is rendered from it
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %d files in state directory", len(entries))
+	}
+}
+
+func TestStateSaverLimitsWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, stateFileMapData)
+	if err := os.WriteFile(path, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Data already on disk is not rewritten
+	s := newStateSaver(dir, 50*time.Millisecond)
+	s.saveMap([]byte("a"))
+	if fi, err := os.Stat(path); err != nil || !fi.ModTime().Equal(old) {
+		t.Fatalf("unchanged map data was rewritten (%v)", err)
+	}
+
+	// First change is written immediately
+	s.saveMap([]byte("b"))
+	if data, _ := os.ReadFile(path); string(data) != "b" {
+		t.Fatalf("got %q after first change", data)
+	}
+
+	// Later changes are delayed until interval ends, only latest one is written
+	s.saveMap([]byte("c"))
+	s.saveMap([]byte("d"))
+	if data, _ := os.ReadFile(path); string(data) != "b" {
+		t.Fatalf("got %q before interval ended", data)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if data, _ := os.ReadFile(path); string(data) != "d" {
+		t.Fatalf("got %q after interval ended", data)
+	}
+}
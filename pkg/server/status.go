@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+type renderStatus struct {
+	Rendered       int        `json:"rendered"`
+	Failed         int        `json:"failed"`
+	LastRenderedAt *time.Time `json:"last_rendered_at"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastErrorAt    *time.Time `json:"last_error_at,omitempty"`
+}
+
+var (
+	status    = &renderStatus{}
+	statusMux = &sync.RWMutex{}
+)
+
+func recordRenderSuccess() {
+	now := time.Now()
+	statusMux.Lock()
+	status.Rendered++
+	status.LastRenderedAt = &now
+	statusMux.Unlock()
+}
+
+// Logs and counts the failure, then returns JSON event for MQTT error topic.
+func recordRenderFailure(msg string, err error) []byte {
+	log.Println(msg, err)
+
+	now := time.Now()
+	statusMux.Lock()
+	status.Failed++
+	status.LastError = msg + " " + err.Error()
+	status.LastErrorAt = &now
+	event := struct {
+		Error  string    `json:"error"`
+		At     time.Time `json:"at"`
+		Failed int       `json:"failed"`
+	}{status.LastError, now, status.Failed}
+	statusMux.Unlock()
+
+	jsonData, _ := json.Marshal(event)
+	return jsonData
+}
+
+func getRenderStatusJSON() ([]byte, error) {
+	statusMux.RLock()
+	defer statusMux.RUnlock()
+	return json.Marshal(status)
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"log"
+	"time"
+)
+
+// Replaced in tests to control time
+var (
+	timeNow   = time.Now
+	timeAfter = time.After
+)
+
+// Passes payloads through, but not more often than once per interval. Payloads
+// arriving too early are not dropped - the latest of them is passed through once
+// the interval ends, so the final map update (e.g. after docking) is never lost.
+func throttle(in chan []byte, interval time.Duration) chan []byte {
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+
+		nextAt := timeNow()
+		var pending []byte
+		var pendingTimer <-chan time.Time
+		for {
+			select {
+			case payload, ok := <-in:
+				if !ok {
+					if pending != nil {
+						out <- pending
+					}
+					return
+				}
+				now := timeNow()
+				if now.Before(nextAt) {
+					if pending == nil {
+						log.Println("Deferring image render due to min_refresh_int")
+						pendingTimer = timeAfter(nextAt.Sub(now))
+					}
+					pending = payload
+					continue
+				}
+				// Deferred payload is older than this one, so it must not be
+				// passed through later
+				pending = nil
+				pendingTimer = nil
+				out <- payload
+			case <-pendingTimer:
+				out <- pending
+				pending = nil
+				pendingTimer = nil
+			}
+			nextAt = timeNow().Add(interval)
+		}
+	}()
+	return out
+}
+
+// Keeps only the newest payload while the receiver is busy, so bursts of updates
+// never cause outdated maps to be rendered.
+func coalesce(in chan []byte) chan []byte {
+	out := make(chan []byte, 1)
+	go func() {
+		defer close(out)
+		for payload := range in {
+			select {
+			case <-out:
+				log.Println("Skipping outdated map payload")
+			default:
+			}
+			out <- payload
+		}
+	}()
+	return out
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now    time.Time
+	timers chan chan time.Time
+}
+
+func setFakeClock(t *testing.T) *fakeClock {
+	t.Helper()
+	c := &fakeClock{now: time.Unix(0, 0), timers: make(chan chan time.Time, 10)}
+	timeNow = func() time.Time { return c.now }
+	timeAfter = func(time.Duration) <-chan time.Time {
+		timer := make(chan time.Time, 1)
+		c.timers <- timer
+		return timer
+	}
+	t.Cleanup(func() { timeNow, timeAfter = time.Now, time.After })
+	return c
+}
+
+func receive(t *testing.T, out chan []byte) string {
+	t.Helper()
+	select {
+	case payload, ok := <-out:
+		if !ok {
+			return "closed"
+		}
+		return string(payload)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for payload")
+		return ""
+	}
+}
+
+func TestThrottleDefersLatest(t *testing.T) {
+	clock := setFakeClock(t)
+	in := make(chan []byte)
+	out := throttle(in, 10*time.Second)
+
+	in <- []byte("1")
+	if got := receive(t, out); got != "1" {
+		t.Fatalf("got %s, want 1", got)
+	}
+
+	in <- []byte("2")
+	in <- []byte("3")
+	timer := <-clock.timers
+	timer <- clock.now
+	if got := receive(t, out); got != "3" {
+		t.Fatalf("got %s, want 3", got)
+	}
+
+	close(in)
+	if got := receive(t, out); got != "closed" {
+		t.Fatalf("got %s, want closed", got)
+	}
+}
+
+// Newer payload can arrive after the interval ended, but before the timer of
+// deferred payload is handled. Deferred payload must not overwrite it then.
+func TestThrottlePassThroughDropsPending(t *testing.T) {
+	clock := setFakeClock(t)
+	in := make(chan []byte)
+	out := throttle(in, 10*time.Second)
+
+	in <- []byte("1")
+	if got := receive(t, out); got != "1" {
+		t.Fatalf("got %s, want 1", got)
+	}
+
+	in <- []byte("2")
+	timer := <-clock.timers
+
+	clock.now = clock.now.Add(11 * time.Second)
+	in <- []byte("3")
+	if got := receive(t, out); got != "3" {
+		t.Fatalf("got %s, want 3", got)
+	}
+
+	// Late timer must not pass older payload through
+	timer <- clock.now
+	close(in)
+	if got := receive(t, out); got != "closed" {
+		t.Fatalf("got %s, want closed", got)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"log"
+	"sync"
+
+	"github.com/erkexzcx/valetudopng/pkg/config"
+	"github.com/erkexzcx/valetudopng/pkg/history"
+	"github.com/erkexzcx/valetudopng/pkg/renderer"
+	"github.com/erkexzcx/valetudopng/pkg/timelapse"
+)
+
+// Returns copy of map config for rendering time-lapse frames, with overridden
+// scale if it's set.
+func TimelapseMapConfig(c *config.MapConfig, scale float64) *config.MapConfig {
+	mc := *c
+	if scale > 0 {
+		mc.Scale = scale
+	}
+	return &mc
+}
+
+// Renders given (decoded) map payloads as animated GIF. Payloads, which fail to
+// render, are skipped.
+func RenderTimelapse(r *renderer.Renderer, c *config.MapConfig, payloads [][]byte, o *timelapse.Options) ([]byte, error) {
+	frames := make([]*image.Paletted, 0)
+	for _, i := range timelapse.SelectFrames(len(payloads), o.MaxFrames) {
+		res, err := r.Render(payloads[i], c)
+		if err != nil {
+			log.Println("Skipping time-lapse frame:", err)
+			continue
+		}
+		frames = append(frames, timelapse.NewFrame(*res.Image))
+	}
+
+	var b bytes.Buffer
+	if err := timelapse.Encode(&b, frames, o); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Font faces of renderer must not be used concurrently, so time-lapses of
+// sessions, which finished close to each other, are rendered one by one.
+var timelapseMux sync.Mutex
+
+// Time-lapse takes a while to render, so it's done in background
+func saveSessionTimelapse(c *config.HistoryConfig, r *renderer.Renderer, mc *config.MapConfig, s *history.Session) {
+	o := &timelapse.Options{
+		FrameRate: c.Timelapse.FrameRate,
+		MaxFrames: c.Timelapse.MaxFrames,
+	}
+	go func() {
+		timelapseMux.Lock()
+		gif, err := RenderTimelapse(r, mc, s.Payloads, o)
+		timelapseMux.Unlock()
+		if err != nil {
+			log.Println("Failed to render cleaning session time-lapse:", err)
+			return
+		}
+		if err := sessions.SaveTimelapse(s.ID, gif); err != nil {
+			log.Println("Failed to save cleaning session time-lapse:", err)
+		}
+	}()
+}
@@ -0,0 +1,76 @@
+// Package timelapse assembles rendered map images into an animated GIF.
+package timelapse
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"math"
+)
+
+// Last frame is shown longer, so the final map is visible before animation loops
+const lastFrameDelay = 300 // 100ths of a second
+
+// First palette color is transparent, as map images have transparent background
+var framePalette = append(color.Palette{color.Transparent}, palette.Plan9[:255]...)
+
+type Options struct {
+	FrameRate float64 // Frames per second
+	MaxFrames int     // Frames are evenly skipped if there are more
+}
+
+// Returns indexes of frames to use out of total frames, evenly spread and always
+// including the first and the last ones.
+func SelectFrames(total, maxFrames int) []int {
+	count := min(total, maxFrames)
+	if maxFrames <= 0 {
+		count = total
+	}
+	indexes := make([]int, 0, count)
+	if count == 1 {
+		return append(indexes, total-1)
+	}
+	for i := 0; i < count; i++ {
+		indexes = append(indexes, int(math.Round(float64(i)*float64(total-1)/float64(count-1))))
+	}
+	return indexes
+}
+
+// Converts rendered image to GIF frame. Frames take 4 times less memory than
+// rendered images, so convert them as soon as they are rendered.
+func NewFrame(img image.Image) *image.Paletted {
+	bounds := image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
+	frame := image.NewPaletted(bounds, framePalette)
+	draw.Draw(frame, bounds, img, img.Bounds().Min, draw.Src)
+	return frame
+}
+
+// Encodes given frames as looping animated GIF. Frames are expected to be already
+// selected using SelectFrames.
+func Encode(w io.Writer, frames []*image.Paletted, o *Options) error {
+	if len(frames) == 0 {
+		return errors.New("no frames to encode")
+	}
+	if o.FrameRate <= 0 {
+		return errors.New("frame rate must be positive")
+	}
+
+	// Map grows while robot explores it, so canvas must fit the largest frame
+	anim := &gif.GIF{}
+	delay := max(int(math.Round(100/o.FrameRate)), 1)
+	for _, frame := range frames {
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+		anim.Config.Width = max(anim.Config.Width, frame.Bounds().Dx())
+		anim.Config.Height = max(anim.Config.Height, frame.Bounds().Dy())
+	}
+	anim.Delay[len(anim.Delay)-1] = max(lastFrameDelay, delay)
+	anim.Config.ColorModel = framePalette
+
+	return gif.EncodeAll(w, anim)
+}
@@ -0,0 +1,67 @@
+package timelapse
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"reflect"
+	"testing"
+)
+
+func TestSelectFrames(t *testing.T) {
+	tests := []struct {
+		total, maxFrames int
+		want             []int
+	}{
+		{1, 10, []int{0}},
+		{3, 10, []int{0, 1, 2}},
+		{10, 4, []int{0, 3, 6, 9}},
+		{10, 1, []int{9}},
+		{5, 0, []int{0, 1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		if got := SelectFrames(tt.total, tt.maxFrames); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SelectFrames(%d, %d): got %v, want %v", tt.total, tt.maxFrames, got, tt.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	// Map grows over time
+	frames := make([]*image.Paletted, 0)
+	for i := 1; i <= 3; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, i*10, i*5))
+		img.Set(0, 0, color.RGBA{0xff, 0x00, 0x00, 0xff})
+		frames = append(frames, NewFrame(img))
+	}
+
+	var b bytes.Buffer
+	if err := Encode(&b, frames, &Options{FrameRate: 4}); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(anim.Image) != 3 {
+		t.Fatalf("got %d frames, want 3", len(anim.Image))
+	}
+	if anim.Config.Width != 30 || anim.Config.Height != 15 {
+		t.Errorf("got size %dx%d, want 30x15", anim.Config.Width, anim.Config.Height)
+	}
+	if !reflect.DeepEqual(anim.Delay, []int{25, 25, lastFrameDelay}) {
+		t.Errorf("got delays %v", anim.Delay)
+	}
+	if _, _, _, a := anim.Image[0].At(1, 1).RGBA(); a != 0 {
+		t.Error("got opaque background, want transparent")
+	}
+	if r, _, _, _ := anim.Image[0].At(0, 0).RGBA(); r != 0xffff {
+		t.Error("got wrong pixel color")
+	}
+
+	if err := Encode(&b, nil, &Options{FrameRate: 4}); err == nil {
+		t.Error("got no error without frames")
+	}
+}